@@ -36,6 +36,8 @@ const (
 	goFumpt    = "mvdan.cc/gofumpt"
 	dirK8s     = "./docs/kubernetes"
 	dirTerra   = "./docs/terraform"
+	// dirCheckpoint is where the progress of the pipeline is stored.
+	dirCheckpoint = ".lingon/checkpoint"
 )
 
 type Result struct {
@@ -93,7 +95,7 @@ func main() {
 }
 
 func Main(logger *slog.Logger) error {
-	var cover, lint, generate, examples, nodiff, pr, scan, release, update, V bool
+	var cover, lint, generate, examples, nodiff, pr, scan, release, update, checkpoint, reset, V bool
 	flag.BoolVar(&cover, "cover", false, "tests with coverage")
 	flag.BoolVar(&lint, "lint", false, "linting and formatting code (gofumpt, golangci-lint)")
 	flag.BoolVar(&generate, "generate", false, "generate all docs and readme")
@@ -103,6 +105,8 @@ func Main(logger *slog.Logger) error {
 	flag.BoolVar(&scan, "scan", false, "scan for vulnerabilities")
 	flag.BoolVar(&release, "release", false, "create a new release")
 	flag.BoolVar(&update, "update", false, "update dependencies")
+	flag.BoolVar(&checkpoint, "checkpoint", false, "resume from the last successful step of a failed run")
+	flag.BoolVar(&reset, "reset", false, "discard the checkpoint of a failed run with the same flags")
 	flag.BoolVar(&V, "verbose", false, "verbose logging")
 
 	flag.Parse()
@@ -121,19 +125,19 @@ func Main(logger *slog.Logger) error {
 	p := wf.NewPipeline(mid...)
 
 	if update {
-		p.Steps = append(p.Steps, wf.Series(mid,
+		p.Steps = append(p.Steps, wf.Named[Result]("update", wf.Series(mid,
 			run(V, ".", "go", "get", "-u", "./..."),
 			run(V, ".", "go", "mod", "tidy"),
 			run(V, dirK8s, "go", "get", "-u", "./..."),
 			run(V, dirK8s, "go", "mod", "tidy"),
 			run(V, dirTerra, "go", "get", "-u", "./..."),
 			run(V, dirTerra, "go", "mod", "tidy"),
-		))
+		)))
 	}
 
 	if cover {
 		coverOut := "cover.out"
-		p.Steps = append(p.Steps, wf.Series(mid,
+		p.Steps = append(p.Steps, wf.Named[Result]("cover", wf.Series(mid,
 			run(V, ".", "go", "test", "-coverprofile="+coverOut, "-covermode=count", "./pkg/..."),
 			run(V, ".", "go", "tool", "cover", "-func="+coverOut),
 			wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
@@ -154,19 +158,19 @@ func Main(logger *slog.Logger) error {
 				}
 				return r, nil
 			}),
-		))
+		)))
 	}
 
 	if lint {
-		p.Steps = append(p.Steps, wf.Series(mid,
+		p.Steps = append(p.Steps, wf.Named[Result]("lint", wf.Series(mid,
 			run(V, ".", "go", "mod", "tidy"),
 			run(V, ".", "go", "run", goFumpt, "-w", "-extra", "."),
 			run(V, ".", "go", "run", goCILint, vargs, "run", "./..."),
-		))
+		)))
 	}
 
 	if generate {
-		p.Steps = append(p.Steps, wf.Parallel(mid, wf.MergeTransform[Result](mergo.WithAppendSlice),
+		p.Steps = append(p.Steps, wf.Named[Result]("generate", wf.Parallel(mid, wf.MergeTransform[Result](mergo.WithAppendSlice),
 			wf.Series(mid,
 				run(V, ".", "go", genargs...),
 				run(V, ".", "go", "mod", "tidy"),
@@ -179,11 +183,11 @@ func Main(logger *slog.Logger) error {
 				run(V, dirTerra, "go", genargs...),
 				run(V, dirTerra, "go", "mod", "tidy"),
 			),
-		))
+		)))
 	}
 
 	if examples {
-		p.Steps = append(p.Steps, wf.Parallel(mid, wf.MergeTransform[Result](mergo.WithAppendSlice),
+		p.Steps = append(p.Steps, wf.Named[Result]("examples", wf.Parallel(mid, wf.MergeTransform[Result](mergo.WithAppendSlice),
 			wf.Series(mid,
 				run(V, dirK8s, "go", "mod", "tidy"),
 				run(V, dirK8s, "go", genargs...),
@@ -194,11 +198,11 @@ func Main(logger *slog.Logger) error {
 				run(V, dirTerra, "go", genargs...),
 				run(V, dirTerra, "go", "test", "-mod=readonly", vargs, "./..."),
 			),
-		))
+		)))
 	}
 
 	if pr {
-		p.Steps = append(p.Steps, wf.Series(mid,
+		p.Steps = append(p.Steps, wf.Named[Result]("pr", wf.Series(mid,
 			run(V, ".", "go", genargs...),
 			run(V, ".", "go", "test", vargs, "./..."),
 			run(V, ".", "go", "mod", "tidy"),
@@ -209,18 +213,18 @@ func Main(logger *slog.Logger) error {
 			// run(V, dirTerra, "go", "mod", "tidy"),
 			run(V, ".", "go", "tool", goFumpt, "-w", "-extra", "."),
 			run(V, ".", "go", "tool", goCILint, vargs, "run", "./..."),
-		))
+		)))
 	}
 
 	if scan {
-		p.Steps = append(p.Steps, wf.Series(mid,
+		p.Steps = append(p.Steps, wf.Named[Result]("scan", wf.Series(mid,
 			run(V, ".", "go", "tool", goVuln, "./..."),
 			run(V, ".", "go", "tool", osvScanner, "."),
-		))
+		)))
 	}
 
 	if release {
-		p.Steps = append(p.Steps, wf.Series(mid,
+		p.Steps = append(p.Steps, wf.Named[Result]("release", wf.Series(mid,
 			run(V, ".", "git", "rev-parse", "--short", "HEAD"),
 			wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
 				if r.Context == nil {
@@ -246,12 +250,12 @@ func Main(logger *slog.Logger) error {
 				r.Stack(&Task{Cmd: cmd.String(), Output: string(o)})
 				return r, nil
 			}),
-		))
+		)))
 	}
 
 	// should be last
 	if nodiff {
-		p.Steps = append(p.Steps, wf.Series(mid,
+		p.Steps = append(p.Steps, wf.Named[Result]("nodiff", wf.Series(mid,
 			run(V, ".", "git", "--no-pager", "diff"),
 			wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
 				if r.Context != nil && len(r.Context.Output) != 0 {
@@ -260,7 +264,23 @@ func Main(logger *slog.Logger) error {
 				}
 				return r, nil
 			}),
-		))
+		)))
+	}
+
+	// The checkpoint is kept per selection of stages, so that a run with
+	// other flags does not resume it.
+	stages := make([]string, 0, len(p.Steps))
+	for _, s := range p.Steps {
+		stages = append(stages, wf.Name(s))
+	}
+	ckpt := wf.NewCheckpoint(dirCheckpoint, "ci-"+strings.Join(stages, "-"))
+	if reset {
+		if err := ckpt.Reset(); err != nil {
+			return fmt.Errorf("reset checkpoint: %w", err)
+		}
+	}
+	if checkpoint {
+		p.Checkpoint = ckpt
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(),
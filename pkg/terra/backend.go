@@ -0,0 +1,126 @@
+// Copyright (c) 2024 Volvo Car Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package terra
+
+// This file contains typed implementations of the most common Terraform
+// backends. Required attributes are plain strings and validated with the
+// `validate:"required"` tag. Optional attributes are pointers so that they are
+// not rendered when unset.
+
+var (
+	_ Backend = (*BackendS3)(nil)
+	_ Backend = (*BackendGCS)(nil)
+	_ Backend = (*BackendAzureRM)(nil)
+	_ Backend = (*BackendHTTP)(nil)
+	_ Backend = (*BackendLocal)(nil)
+	_ Backend = (*BackendPG)(nil)
+)
+
+// BackendS3 implements the Terraform s3 backend type.
+// https://developer.hashicorp.com/terraform/language/settings/backends/s3
+type BackendS3 struct {
+	Bucket string `hcl:"bucket,attr" validate:"required"`
+	Key    string `hcl:"key,attr"    validate:"required"`
+	Region string `hcl:"region,attr" validate:"required"`
+
+	Profile       *string `hcl:"profile,attr"`
+	RoleARN       *string `hcl:"role_arn,attr"`
+	Encrypt       *bool   `hcl:"encrypt,attr"`
+	KMSKeyID      *string `hcl:"kms_key_id,attr"`
+	DynamoDBTable *string `hcl:"dynamodb_table,attr"`
+	// UseLockfile enables S3 native state locking.
+	UseLockfile        *bool   `hcl:"use_lockfile,attr"`
+	WorkspaceKeyPrefix *string `hcl:"workspace_key_prefix,attr"`
+}
+
+// BackendType defines the type of the backend.
+func (b *BackendS3) BackendType() string {
+	return "s3"
+}
+
+// BackendGCS implements the Terraform gcs backend type.
+// https://developer.hashicorp.com/terraform/language/settings/backends/gcs
+type BackendGCS struct {
+	Bucket string `hcl:"bucket,attr" validate:"required"`
+
+	Prefix                    *string `hcl:"prefix,attr"`
+	Credentials               *string `hcl:"credentials,attr"`
+	ImpersonateServiceAccount *string `hcl:"impersonate_service_account,attr"`
+	EncryptionKey             *string `hcl:"encryption_key,attr"`
+	KMSEncryptionKey          *string `hcl:"kms_encryption_key,attr"`
+	StorageCustomEndpoint     *string `hcl:"storage_custom_endpoint,attr"`
+}
+
+// BackendType defines the type of the backend.
+func (b *BackendGCS) BackendType() string {
+	return "gcs"
+}
+
+// BackendAzureRM implements the Terraform azurerm backend type.
+// https://developer.hashicorp.com/terraform/language/settings/backends/azurerm
+type BackendAzureRM struct {
+	StorageAccountName string `hcl:"storage_account_name,attr" validate:"required"`
+	ContainerName      string `hcl:"container_name,attr"       validate:"required"`
+	Key                string `hcl:"key,attr"                  validate:"required"`
+
+	ResourceGroupName *string `hcl:"resource_group_name,attr"`
+	SubscriptionID    *string `hcl:"subscription_id,attr"`
+	TenantID          *string `hcl:"tenant_id,attr"`
+	ClientID          *string `hcl:"client_id,attr"`
+	UseAzureADAuth    *bool   `hcl:"use_azuread_auth,attr"`
+	UseOIDC           *bool   `hcl:"use_oidc,attr"`
+}
+
+// BackendType defines the type of the backend.
+func (b *BackendAzureRM) BackendType() string {
+	return "azurerm"
+}
+
+// BackendHTTP implements the Terraform http backend type.
+// https://developer.hashicorp.com/terraform/language/settings/backends/http
+type BackendHTTP struct {
+	Address string `hcl:"address,attr" validate:"required,url"`
+
+	UpdateMethod  *string `hcl:"update_method,attr"`
+	LockAddress   *string `hcl:"lock_address,attr"`
+	LockMethod    *string `hcl:"lock_method,attr"`
+	UnlockAddress *string `hcl:"unlock_address,attr"`
+	UnlockMethod  *string `hcl:"unlock_method,attr"`
+	Username      *string `hcl:"username,attr"`
+	Password      *string `hcl:"password,attr"`
+}
+
+// BackendType defines the type of the backend.
+func (b *BackendHTTP) BackendType() string {
+	return "http"
+}
+
+// BackendLocal implements the Terraform local backend type.
+// https://developer.hashicorp.com/terraform/language/settings/backends/local
+type BackendLocal struct {
+	Path string `hcl:"path,attr" validate:"required"`
+
+	WorkspaceDir *string `hcl:"workspace_dir,attr"`
+}
+
+// BackendType defines the type of the backend.
+func (b *BackendLocal) BackendType() string {
+	return "local"
+}
+
+// BackendPG implements the Terraform pg (PostgreSQL) backend type.
+// https://developer.hashicorp.com/terraform/language/settings/backends/pg
+type BackendPG struct {
+	ConnStr string `hcl:"conn_str,attr" validate:"required"`
+
+	SchemaName         *string `hcl:"schema_name,attr"`
+	SkipSchemaCreation *bool   `hcl:"skip_schema_creation,attr"`
+	SkipTableCreation  *bool   `hcl:"skip_table_creation,attr"`
+	SkipIndexCreation  *bool   `hcl:"skip_index_creation,attr"`
+}
+
+// BackendType defines the type of the backend.
+func (b *BackendPG) BackendType() string {
+	return "pg"
+}
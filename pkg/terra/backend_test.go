@@ -0,0 +1,98 @@
+// Copyright (c) 2024 Volvo Car Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package terra
+
+import (
+	"bytes"
+	"testing"
+
+	tu "github.com/golingon/lingon/pkg/testutil"
+)
+
+func TestExportBackend(t *testing.T) {
+	type backendStack struct {
+		Stack
+		Backend *BackendLocal
+	}
+	encrypt := true
+	profile := "default"
+	type test struct {
+		name    string
+		backend Backend
+		want    string
+		wantErr string
+	}
+	tests := []test{
+		{
+			name: "s3",
+			backend: &BackendS3{
+				Bucket:  "bucket",
+				Key:     "some/key",
+				Region:  "eu-north-1",
+				Profile: &profile,
+				Encrypt: &encrypt,
+			},
+			want: `terraform {
+  backend "s3" {
+    bucket  = "bucket"
+    key     = "some/key"
+    region  = "eu-north-1"
+    profile = "default"
+    encrypt = true
+  }
+}
+
+`,
+		},
+		{
+			name:    "override",
+			backend: &BackendPG{ConnStr: "postgres://localhost/state"},
+			want: `terraform {
+  backend "pg" {
+    conn_str = "postgres://localhost/state"
+  }
+}
+
+`,
+		},
+		{
+			name:    "missing required",
+			backend: &BackendGCS{},
+			wantErr: "encoding stack: validating stack: backend validation failed: Key: 'BackendGCS.Bucket' Error:Field validation for 'Bucket' failed on the 'required' tag",
+		},
+		{
+			name:    "invalid url",
+			backend: &BackendHTTP{Address: "not a url"},
+			wantErr: "encoding stack: validating stack: backend validation failed: Key: 'BackendHTTP.Address' Error:Field validation for 'Address' failed on the 'url' tag",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := backendStack{Backend: &BackendLocal{Path: "terraform.tfstate"}}
+			var b bytes.Buffer
+			err := Export(
+				&st,
+				WithExportWriter(&b),
+				WithExportBackend(tt.backend),
+			)
+			if tt.wantErr != "" {
+				tu.AssertErrorMsg(t, err, tt.wantErr)
+				return
+			}
+			tu.AssertNoError(t, err)
+			tu.AssertEqual(t, tt.want, b.String())
+		})
+	}
+
+	t.Run("stack backend", func(t *testing.T) {
+		st := backendStack{Backend: &BackendLocal{}}
+		var b bytes.Buffer
+		err := Export(&st, WithExportWriter(&b))
+		tu.AssertErrorMsg(
+			t,
+			err,
+			"encoding stack: stack validation failed: Key: 'backendStack.Backend.Path' Error:Field validation for 'Path' failed on the 'required' tag",
+		)
+	})
+}
@@ -9,7 +9,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/golingon/lingon/pkg/internal/hcl"
 )
 
@@ -38,11 +40,33 @@ func WithExportOutputDirectory(dir string) ExportOption {
 	}
 }
 
+// WithExportBackend sets the backend of the exported Terraform configuration,
+// overriding the backend of the stack (if any).
+// This is useful when the same stack is deployed with different backends.
+func WithExportBackend(b Backend) ExportOption {
+	return func(g *gotf) {
+		g.backend = b
+	}
+}
+
 type gotf struct {
 	useWriter bool
 	w         io.Writer
 
-	dir string
+	dir     string
+	backend Backend
+}
+
+// objects returns the objects of the stack, with the export options applied.
+func (g *gotf) objects(stack Exporter) (*StackObjects, error) {
+	blocks, err := ObjectsFromStack(stack)
+	if err != nil {
+		return nil, err
+	}
+	if g.backend != nil {
+		blocks.Backend = g.backend
+	}
+	return blocks, nil
 }
 
 // Export encodes [Exporter] to Terraform configurations
@@ -52,8 +76,13 @@ func Export(stack Exporter, opts ...ExportOption) error {
 		o(&g)
 	}
 
+	blocks, err := g.objects(stack)
+	if err != nil {
+		return fmt.Errorf("encoding stack: %w", err)
+	}
+
 	if g.useWriter {
-		if err := encodeStack(stack, g.w); err != nil {
+		if err := encodeObjects(blocks, g.w); err != nil {
 			return fmt.Errorf(
 				"encoding stack: %w", err,
 			)
@@ -79,7 +108,7 @@ func Export(stack Exporter, opts ...ExportOption) error {
 		return err
 	}
 	defer f.Close()
-	if err := encodeStack(stack, f); err != nil {
+	if err := encodeObjects(blocks, f); err != nil {
 		return fmt.Errorf(
 			"encoding stack: %w", err,
 		)
@@ -93,6 +122,10 @@ func encodeStack(stack Exporter, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	return encodeObjects(blocks, w)
+}
+
+func encodeObjects(blocks *StackObjects, w io.Writer) error {
 	if err := validateStack(blocks); err != nil {
 		return fmt.Errorf("validating stack: %w", err)
 	}
@@ -150,5 +183,22 @@ func validateStack(sb *StackObjects) error {
 	if (len(sb.Resources)+len(sb.DataSources)) > 0 && len(sb.Providers) == 0 {
 		return ErrNoProviderBlock
 	}
+	// The backend is validated whether it is defined in the stack or set
+	// with WithExportBackend.
+	if sb.Backend != nil && isStruct(sb.Backend) {
+		if err := validator.New().Struct(sb.Backend); err != nil {
+			return fmt.Errorf("backend validation failed: %w", err)
+		}
+	}
 	return nil
 }
+
+// isStruct returns true if v is a struct or a pointer to a struct, which are
+// the only values the validator accepts.
+func isStruct(v any) bool {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
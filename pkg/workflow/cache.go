@@ -0,0 +1,305 @@
+package workflow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrCacheUnnamedStep = errors.New("cached step has no name")
+
+// CacheStore stores the results of cached steps, see [CacheMiddleware].
+// It must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value for the key, and false if there is none or it
+	// expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value for the key, expiring after ttl.
+	// A ttl of zero or less never expires.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the value for the key, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheHashFunc returns a hash of the request, which identifies the inputs of
+// a step, e.g. a checksum of the files it builds.
+type CacheHashFunc[T any] func(context.Context, *T) (string, error)
+
+// CacheMiddleware caches the results of successful steps in the store, so that
+// a step runs only once for the same inputs until the result expires after
+// ttl (zero or less never expires).
+//
+// The key is derived from the step name (see [GetStepName]) and the hash of
+// the request, see [CacheKey]. All the [StepFunc] (and [MidFunc]) of a type
+// have the same name, so they must be named with [Named], which sets the key
+// explicitly, otherwise the step fails with an error wrapping
+// [ErrCacheUnnamedStep].
+// Results are encoded as JSON, so T must support it.
+//
+// Hits and misses are counted by the [CacheStats] in the context, see
+// [WithCacheStats], and recorded on the current span (if any).
+// The cache is bypassed in dry-run mode, see [WithDryRun].
+func CacheMiddleware[T any](
+	store CacheStore,
+	hash CacheHashFunc[T],
+	ttl time.Duration,
+) Middleware[T] {
+	return func(next Step[T]) Step[T] {
+		return wrapStep(next, func(ctx context.Context, req *T) (*T, error) {
+			name, err := GetStepName(ctx)
+			if err != nil {
+				name = Name(next)
+			}
+			if isFuncName[T](name) {
+				return nil, fmt.Errorf("%w: %s", ErrCacheUnnamedStep, name)
+			}
+			// A dry run neither uses nor stores results.
+			if IsDryRun(ctx) {
+				return next.Run(ctx, req)
+			}
+			h, err := hash(ctx, req)
+			if err != nil {
+				return nil, fmt.Errorf("hashing request of %s: %w", name, err)
+			}
+			key := CacheKey(name, h)
+
+			b, ok, err := store.Get(ctx, key)
+			if err != nil {
+				return nil, fmt.Errorf("getting cache for %s: %w", name, err)
+			}
+			if ok {
+				resp := new(T)
+				if err := json.Unmarshal(b, resp); err == nil {
+					recordCache(ctx, true)
+					return resp, nil
+				}
+				// A result which cannot be decoded, e.g. because T changed,
+				// is a miss.
+			}
+			recordCache(ctx, false)
+
+			resp, err := next.Run(ctx, req)
+			if err != nil {
+				return resp, err
+			}
+			b, err = json.Marshal(resp)
+			if err != nil {
+				return resp, fmt.Errorf("encoding result of %s: %w", name, err)
+			}
+			if err := store.Set(ctx, key, b, ttl); err != nil {
+				return resp, fmt.Errorf("setting cache for %s: %w", name, err)
+			}
+			return resp, nil
+		})
+	}
+}
+
+// isFuncName reports whether the name is the default name of a [StepFunc] or
+// [MidFunc], which does not identify the step.
+func isFuncName[T any](name string) bool {
+	return name == Name[T](StepFunc[T](nil)) || name == Name[T](MidFunc[T](nil))
+}
+
+// CacheKey returns the cache key of a step with the given name and request
+// hash, e.g. to invalidate it with [CacheStore.Delete].
+func CacheKey(name, hash string) string {
+	return name + "/" + hash
+}
+
+// CacheStats counts the cache hits and misses of [CacheMiddleware].
+type CacheStats struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (s *CacheStats) Hits() int64 {
+	return s.hits.Load()
+}
+
+func (s *CacheStats) Misses() int64 {
+	return s.misses.Load()
+}
+
+// WithCacheStats sets the stats counting the cache hits and misses of the
+// steps run with the context.
+func WithCacheStats(ctx context.Context, s *CacheStats) context.Context {
+	return context.WithValue(ctx, cacheStatsKey, s)
+}
+
+func recordCache(ctx context.Context, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	SpanFromContext(ctx).SetAttr("cache", result)
+	s, ok := ctx.Value(cacheStatsKey).(*CacheStats)
+	if !ok {
+		return
+	}
+	if hit {
+		s.hits.Add(1)
+		return
+	}
+	s.misses.Add(1)
+}
+
+// Stores
+
+var (
+	_ CacheStore = (*MemoryCacheStore)(nil)
+	_ CacheStore = (*DirCacheStore)(nil)
+)
+
+type cacheEntry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+func newCacheEntry(value []byte, ttl time.Duration) cacheEntry {
+	e := cacheEntry{Value: value}
+	if ttl > 0 {
+		e.Expires = time.Now().Add(ttl)
+	}
+	return e
+}
+
+func (e cacheEntry) expired() bool {
+	return !e.Expires.IsZero() && time.Now().After(e.Expires)
+}
+
+// MemoryCacheStore keeps the cache in memory, for the lifetime of the process.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{entries: map[string]cacheEntry{}}
+}
+
+func (s *MemoryCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.expired() {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+func (s *MemoryCacheStore) Set(
+	_ context.Context,
+	key string,
+	value []byte,
+	ttl time.Duration,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = newCacheEntry(value, ttl)
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// Clear removes all entries.
+func (s *MemoryCacheStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.entries)
+}
+
+// DirCacheStore keeps the cache in a directory, one file per key, so that it
+// survives between runs, e.g. on a CI runner.
+type DirCacheStore struct {
+	dir string
+}
+
+func NewDirCacheStore(dir string) *DirCacheStore {
+	return &DirCacheStore{dir: dir}
+}
+
+func (s *DirCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *DirCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	b, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, false, fmt.Errorf("decoding cache entry: %w", err)
+	}
+	if e.expired() {
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+func (s *DirCacheStore) Set(
+	_ context.Context,
+	key string,
+	value []byte,
+	ttl time.Duration,
+) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	b, err := json.Marshal(newCacheEntry(value, ttl))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(key), b)
+}
+
+// writeFileAtomic writes to a temporary file first, which is renamed to path,
+// so that concurrent readers never see a partial file.
+func writeFileAtomic(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *DirCacheStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Clear removes the directory and all entries in it.
+func (s *DirCacheStore) Clear() error {
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,116 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+type build struct {
+	Input  string
+	Output string
+}
+
+func hashInput(ctx context.Context, b *build) (string, error) {
+	return b.Input, nil
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	stores := map[string]wf.CacheStore{
+		"memory": wf.NewMemoryCacheStore(),
+		"dir":    wf.NewDirCacheStore(t.TempDir()),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			var runs int
+			step := wf.Named("compile", wf.Step[build](wf.StepFunc[build](
+				func(ctx context.Context, b *build) (*build, error) {
+					runs++
+					b.Output = "compiled " + b.Input
+					return b, nil
+				},
+			)))
+			mid := wf.Mid[build]{
+				wf.CacheMiddleware(store, hashInput, time.Hour),
+			}
+			stats := &wf.CacheStats{}
+			ctx := wf.WithCacheStats(context.Background(), stats)
+			run := func(input string) *build {
+				t.Helper()
+				got, err := wf.Series(mid, step).Run(ctx, &build{Input: input})
+				testutil.AssertNoError(t, err)
+				return got
+			}
+
+			testutil.AssertEqual(t, "compiled a", run("a").Output)
+			testutil.AssertEqual(t, "compiled a", run("a").Output)
+			testutil.AssertEqual(t, "compiled b", run("b").Output)
+			testutil.AssertEqual(t, 2, runs)
+			testutil.AssertEqual(t, int64(1), stats.Hits())
+			testutil.AssertEqual(t, int64(2), stats.Misses())
+
+			// Invalidating the key runs the step again.
+			testutil.AssertNoError(
+				t,
+				store.Delete(ctx, wf.CacheKey("compile", "a")),
+			)
+			run("a")
+			testutil.AssertEqual(t, 3, runs)
+		})
+	}
+}
+
+func TestCacheUnnamedStep(t *testing.T) {
+	store := wf.NewMemoryCacheStore()
+	mid := wf.Mid[build]{wf.CacheMiddleware(store, hashInput, 0)}
+	var runs int
+	compile := func(prefix string) wf.Step[build] {
+		return wf.StepFunc[build](func(ctx context.Context, b *build) (*build, error) {
+			runs++
+			b.Output = prefix + b.Input
+			return b, nil
+		})
+	}
+	ctx := context.Background()
+
+	// Two unnamed steps would share the cache key, so the second would
+	// return the result of the first.
+	_, err := wf.Series(mid, compile("compiled "), compile("linted ")).
+		Run(ctx, &build{Input: "a"})
+	testutil.ErrorIs(t, err, wf.ErrCacheUnnamedStep)
+	testutil.AssertEqual(t, 0, runs)
+
+	got, err := wf.Series(
+		mid,
+		wf.Named("compile", compile("compiled ")),
+		wf.Named("lint", compile("linted ")),
+	).Run(ctx, &build{Input: "a"})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, "linted a", got.Output)
+	testutil.AssertEqual(t, 2, runs)
+}
+
+func TestCacheTTL(t *testing.T) {
+	ttl := 10 * time.Millisecond
+	for name, store := range map[string]wf.CacheStore{
+		"memory": wf.NewMemoryCacheStore(),
+		"dir":    wf.NewDirCacheStore(t.TempDir()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			testutil.AssertNoError(t, store.Set(ctx, "key", []byte("value"), ttl))
+			b, ok, err := store.Get(ctx, "key")
+			testutil.AssertNoError(t, err)
+			testutil.True(t, ok, "value should be cached")
+			testutil.AssertEqual(t, "value", string(b))
+
+			time.Sleep(2 * ttl)
+			_, ok, err = store.Get(ctx, "key")
+			testutil.AssertNoError(t, err)
+			testutil.False(t, ok, "value should have expired")
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+var ErrCheckpointSaga = errors.New("checkpoints are not supported in saga mode")
+
+// Checkpoint stores the progress of a [Pipeline] in a directory, so that a
+// failed run can be resumed, see [Pipeline.Checkpoint].
+//
+// The result of the pipeline is encoded as JSON after each successful step,
+// so T must support it. A checkpoint is only resumed when the completed steps
+// have the same names and are composed of the same steps (see [Describe]) as
+// the first steps of the pipeline, e.g. the steps were not reordered between
+// the runs, otherwise the pipeline starts from the first step.
+// Steps composed differently can still look the same, e.g. two [Series] of
+// [StepFunc], so name them with [Named] or use a checkpoint per pipeline.
+// The checkpoint is removed once the pipeline succeeds, or with
+// [Checkpoint.Reset].
+type Checkpoint struct {
+	dir string
+}
+
+// NewCheckpoint creates a checkpoint for the pipeline named name, stored in a
+// directory of dir.
+func NewCheckpoint(dir, name string) *Checkpoint {
+	return &Checkpoint{dir: filepath.Join(dir, name)}
+}
+
+// checkpointState is the content of a checkpoint file.
+type checkpointState struct {
+	// Steps are the descriptions of the completed steps, see
+	// [checkpointSteps].
+	Steps  []string        `json:"steps"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (c *Checkpoint) path() string {
+	return filepath.Join(c.dir, "checkpoint.json")
+}
+
+// Reset removes the checkpoint, so that the next run starts from the first
+// step.
+func (c *Checkpoint) Reset() error {
+	return os.RemoveAll(c.dir)
+}
+
+// save stores the result of the completed steps.
+func (c *Checkpoint) save(steps []string, result any) error {
+	res, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint result: %w", err)
+	}
+	b, err := json.Marshal(checkpointState{Steps: steps, Result: res})
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("creating checkpoint directory: %w", err)
+	}
+	if err := writeFileAtomic(c.path(), b); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// checkpointSteps returns the description of each step, which identifies it in
+// a checkpoint.
+func checkpointSteps[T any](steps []Step[T]) []string {
+	desc := make([]string, len(steps))
+	for i, s := range steps {
+		desc[i] = Describe(s).Tree()
+	}
+	return desc
+}
+
+// resume returns the index of the first incomplete step and the result of the
+// completed steps, or 0 and the request if there is nothing to resume.
+func resume[T any](c *Checkpoint, steps []string, req *T) (int, *T, error) {
+	b, err := os.ReadFile(c.path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, req, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	var state checkpointState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return 0, nil, fmt.Errorf("decoding checkpoint: %w", err)
+	}
+	n := len(state.Steps)
+	if n > len(steps) || !slices.Equal(state.Steps, steps[:n]) {
+		return 0, req, nil
+	}
+	resp := new(T)
+	if err := json.Unmarshal(state.Result, resp); err != nil {
+		return 0, nil, fmt.Errorf("decoding checkpoint result: %w", err)
+	}
+	return n, resp, nil
+}
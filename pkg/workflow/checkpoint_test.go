@@ -0,0 +1,111 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	var runs []string
+	fail := true
+	step := func(name string) wf.Step[Result] {
+		return wf.Named(name, wf.Step[Result](wf.StepFunc[Result](
+			func(ctx context.Context, r *Result) (*Result, error) {
+				runs = append(runs, name)
+				if name == "test" && fail {
+					return nil, errors.New("flaky")
+				}
+				r.Messages = append(slices.Clone(r.Messages), name)
+				return r, nil
+			},
+		)))
+	}
+	pipeline := func() *wf.Pipeline[Result] {
+		p := wf.NewPipeline[Result]()
+		p.Steps = []wf.Step[Result]{step("lint"), step("build"), step("test")}
+		p.Checkpoint = wf.NewCheckpoint(dir, "ci")
+		return p
+	}
+
+	_, err := pipeline().Run(context.Background(), &Result{})
+	testutil.AssertErrorMsg(t, err, "flaky")
+	testutil.AssertEqualSlice(t, []string{"lint", "build", "test"}, runs)
+
+	// Resumes at the failed step, with the result of the completed steps.
+	runs = nil
+	fail = false
+	res, err := pipeline().Run(context.Background(), &Result{})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualSlice(t, []string{"test"}, runs)
+	testutil.AssertEqualSlice(t, []string{"lint", "build", "test"}, res.Messages)
+
+	// The checkpoint is removed on success.
+	runs = nil
+	_, err = pipeline().Run(context.Background(), &Result{})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualSlice(t, []string{"lint", "build", "test"}, runs)
+
+	t.Run("reset", func(t *testing.T) {
+		fail = true
+		_, err := pipeline().Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(t, err, "flaky")
+		testutil.AssertNoError(t, wf.NewCheckpoint(dir, "ci").Reset())
+
+		runs = nil
+		fail = false
+		_, err = pipeline().Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"lint", "build", "test"}, runs)
+	})
+
+	t.Run("steps changed", func(t *testing.T) {
+		fail = true
+		_, err := pipeline().Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(t, err, "flaky")
+
+		runs = nil
+		fail = false
+		p := pipeline()
+		p.Steps = slices.Insert(p.Steps, 1, step("vet"))
+		_, err = p.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"lint", "vet", "build", "test"}, runs)
+	})
+
+	t.Run("composed differently", func(t *testing.T) {
+		// Both pipelines have a single unnamed series, composed of different
+		// steps.
+		composed := func(steps ...string) *wf.Pipeline[Result] {
+			stages := make([]wf.Step[Result], len(steps))
+			for i, s := range steps {
+				stages[i] = step(s)
+			}
+			p := wf.NewPipeline[Result]()
+			p.Steps = []wf.Step[Result]{wf.Series(nil, stages...), step("test")}
+			p.Checkpoint = wf.NewCheckpoint(dir, "ci")
+			return p
+		}
+		fail = true
+		_, err := composed("lint").Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(t, err, "flaky")
+
+		runs = nil
+		fail = false
+		_, err = composed("build").Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"build", "test"}, runs)
+	})
+
+	t.Run("saga", func(t *testing.T) {
+		p := pipeline()
+		p.Saga = true
+		_, err := p.Run(context.Background(), &Result{})
+		testutil.ErrorIs(t, err, wf.ErrCheckpointSaga)
+	})
+}
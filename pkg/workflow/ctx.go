@@ -16,6 +16,13 @@ type ctxKey int
 const (
 	stepIDKey ctxKey = iota + 1
 	stepStartTime
+	spanKey
+	stepNameKey
+	cacheStatsKey
+	taskErrorsKey
+	dryRunKey
+	eventBusKey
+	stepRunKey
 )
 
 func setStepID(ctx context.Context, stepID uuid.UUID) context.Context {
@@ -30,6 +37,20 @@ func GetStepID(ctx context.Context) (uuid.UUID, error) {
 	return v, nil
 }
 
+func setStepName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, stepNameKey, name)
+}
+
+// GetStepName returns the name of the step being run, as given to [Graph.Add]
+// or [Named], or else the name of its type (see [Name]).
+func GetStepName(ctx context.Context) (string, error) {
+	v, ok := ctx.Value(stepNameKey).(string)
+	if !ok {
+		return "", ErrMissingFromContext
+	}
+	return v, nil
+}
+
 // UUID
 
 // IDGenerator generates globally unique ID [uuid.UUID]. It uses UUID version 7 which time-sorted.
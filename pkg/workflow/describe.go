@@ -0,0 +1,253 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeKind is the kind of a step in the tree returned by [Describe].
+type NodeKind string
+
+const (
+	KindStep     NodeKind = "step"
+	KindPipeline NodeKind = "pipeline"
+	KindSeries   NodeKind = "series"
+	KindParallel NodeKind = "parallel"
+	KindSelect   NodeKind = "select"
+	KindGraph    NodeKind = "graph"
+	KindSaga     NodeKind = "saga"
+	KindSwitch   NodeKind = "switch"
+	KindLoop     NodeKind = "loop"
+	KindForEach  NodeKind = "foreach"
+)
+
+// Node describes a step and the steps it is composed of, see [Describe].
+type Node struct {
+	Name string
+	Kind NodeKind
+	// Label qualifies the node within its parent, e.g. the "if" and "else"
+	// branches of [Select].
+	Label string
+	// Deps are the names of the sibling nodes the node depends on, in a
+	// [Graph].
+	Deps     []string
+	Children []*Node
+}
+
+// describer is implemented by the steps composed of other steps.
+type describer interface {
+	describe() *Node
+}
+
+// Describe walks the step and the steps it is composed of, e.g. to render the
+// shape of a pipeline before running it with [Node.Tree], [Node.DOT] or
+// [Node.Mermaid].
+// Any step which is not composed of other steps is a leaf of kind [KindStep].
+func Describe[T any](s Step[T]) *Node {
+	if d, ok := s.(describer); ok {
+		return d.describe()
+	}
+	return &Node{Name: Name(s), Kind: KindStep}
+}
+
+func describeSteps[T any](steps []Step[T]) []*Node {
+	nodes := make([]*Node, 0, len(steps))
+	for _, s := range steps {
+		nodes = append(nodes, Describe(s))
+	}
+	return nodes
+}
+
+func (p *Pipeline[T]) describe() *Node {
+	kind := KindPipeline
+	if p.Saga {
+		kind = KindSaga
+	}
+	return &Node{Name: Name[T](p), Kind: kind, Children: describeSteps(p.Steps)}
+}
+
+func (s *series[T]) describe() *Node {
+	return &Node{Name: Name[T](s), Kind: KindSeries, Children: describeSteps(s.Stages)}
+}
+
+func (p *parallel[T]) describe() *Node {
+	return &Node{Name: Name[T](p), Kind: KindParallel, Children: describeSteps(p.Tasks)}
+}
+
+func (s selector[T]) describe() *Node {
+	n := &Node{Name: Name[T](&s), Kind: KindSelect}
+	for _, b := range []struct {
+		label string
+		step  Step[T]
+	}{{"if", s.ifStep}, {"else", s.elseStep}} {
+		if b.step == nil {
+			continue
+		}
+		child := Describe(b.step)
+		child.Label = b.label
+		n.Children = append(n.Children, child)
+	}
+	return n
+}
+
+func (g *Graph[T]) describe() *Node {
+	n := &Node{Name: Name[T](g), Kind: KindGraph}
+	for _, gn := range g.nodes {
+		child := Describe(gn.step)
+		child.Name = gn.name
+		child.Deps = gn.deps
+		n.Children = append(n.Children, child)
+	}
+	return n
+}
+
+func (s *saga[T]) describe() *Node {
+	return &Node{Name: Name[T](s), Kind: KindSaga, Children: describeSteps(s.Steps)}
+}
+
+func (n *named[T]) describe() *Node {
+	d := Describe(n.Step)
+	d.Name = n.name
+	return d
+}
+
+func (c *compensable[T]) describe() *Node {
+	return Describe(c.Step)
+}
+
+func (m *midStep[T]) describe() *Node {
+	return Describe(m.next)
+}
+
+// walk calls fn for the node and its descendants, depth first, with the depth
+// of each node and the ID of its parent (-1 for the root).
+// IDs are unique within the tree.
+func (n *Node) walk(fn func(id, parent, depth int, n *Node)) {
+	id := 0
+	var visit func(n *Node, parent, depth int)
+	visit = func(n *Node, parent, depth int) {
+		self := id
+		id++
+		fn(self, parent, depth, n)
+		for _, c := range n.Children {
+			visit(c, self, depth+1)
+		}
+	}
+	visit(n, -1, 0)
+}
+
+// title is the text displayed for the node, excluding its label.
+func (n *Node) title() string {
+	if n.Kind == KindStep {
+		return n.Name
+	}
+	return fmt.Sprintf("%s (%s)", n.Name, n.Kind)
+}
+
+// Tree renders the node as an indented tree, one step per line.
+func (n *Node) Tree() string {
+	var b strings.Builder
+	n.walk(func(_, _, depth int, n *Node) {
+		b.WriteString(strings.Repeat("  ", depth))
+		if n.Label != "" {
+			b.WriteString(n.Label + ": ")
+		}
+		b.WriteString(n.title())
+		if len(n.Deps) > 0 {
+			b.WriteString(" <- " + strings.Join(n.Deps, ", "))
+		}
+		b.WriteString("\n")
+	})
+	return b.String()
+}
+
+// DOT renders the node as a Graphviz graph.
+// Composite steps are linked to the steps they are composed of, and the
+// dependencies between the nodes of a [Graph] are dashed edges.
+func (n *Node) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph workflow {\n")
+	n.edges(func(id int, n *Node) {
+		shape := "box"
+		if n.Kind != KindStep {
+			shape = "folder"
+		}
+		fmt.Fprintf(&b, "  n%d [label=%q, shape=%s];\n", id, n.title(), shape)
+	}, func(from, to int, label string) {
+		if label != "" {
+			fmt.Fprintf(&b, "  n%d -> n%d [label=%q];\n", from, to, label)
+			return
+		}
+		fmt.Fprintf(&b, "  n%d -> n%d;\n", from, to)
+	}, func(from, to int) {
+		fmt.Fprintf(&b, "  n%d -> n%d [style=dashed];\n", from, to)
+	})
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the node as a Mermaid flowchart.
+// Composite steps are linked to the steps they are composed of, and the
+// dependencies between the nodes of a [Graph] are dotted links.
+func (n *Node) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	n.edges(func(id int, n *Node) {
+		fmt.Fprintf(&b, "  n%d[\"%s\"]\n", id, mermaidEscape(n.title()))
+	}, func(from, to int, label string) {
+		if label != "" {
+			fmt.Fprintf(&b, "  n%d -->|%s| n%d\n", from, mermaidEscape(label), to)
+			return
+		}
+		fmt.Fprintf(&b, "  n%d --> n%d\n", from, to)
+	}, func(from, to int) {
+		fmt.Fprintf(&b, "  n%d -.-> n%d\n", from, to)
+	})
+	return b.String()
+}
+
+// edges calls node for each node, then child for each edge from a parent to
+// its child and dep for each dependency between the nodes of a graph.
+func (n *Node) edges(
+	node func(id int, n *Node),
+	child func(from, to int, label string),
+	dep func(from, to int),
+) {
+	type edge struct {
+		from, to int
+		label    string
+	}
+	var children []edge
+	var deps []edge
+	// IDs of the children of each node, by name, to resolve dependencies.
+	ids := map[int]map[string]int{}
+	n.walk(func(id, parent, _ int, n *Node) {
+		node(id, n)
+		if parent < 0 {
+			return
+		}
+		children = append(children, edge{from: parent, to: id, label: n.Label})
+		if ids[parent] == nil {
+			ids[parent] = map[string]int{}
+		}
+		ids[parent][n.Name] = id
+	})
+	n.walk(func(id, parent, _ int, n *Node) {
+		for _, d := range n.Deps {
+			if from, ok := ids[parent][d]; ok {
+				deps = append(deps, edge{from: from, to: id})
+			}
+		}
+	})
+	for _, e := range children {
+		child(e.from, e.to, e.label)
+	}
+	for _, e := range deps {
+		dep(e.from, e.to)
+	}
+}
+
+// mermaidEscape escapes the characters which have a meaning in Mermaid labels.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;").Replace(s)
+}
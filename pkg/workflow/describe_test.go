@@ -0,0 +1,155 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+func describedPipeline() *wf.Pipeline[Result] {
+	always := func(ctx context.Context, r *Result) bool { return true }
+	p := wf.NewPipeline[Result]()
+	p.Steps = []wf.Step[Result]{
+		wf.Named("fetch", message("fetch")),
+		wf.Parallel(nil, mergeMessages, firstStep{}, wf.Named("second", message("second"))),
+		wf.Select(nil, always, wf.Named("deploy", message("deploy")), nil),
+		wf.NewGraph[Result](nil, mergeMessages).
+			Add("a", message("a")).
+			Add("b", message("b"), "a"),
+	}
+	return p
+}
+
+func TestDescribe(t *testing.T) {
+	n := wf.Describe[Result](describedPipeline())
+
+	testutil.AssertEqual(t, `Pipeline[Result] (pipeline)
+  fetch
+  parallel[Result] (parallel)
+    firstStep
+    second
+  selector[Result] (select)
+    if: deploy
+  Graph[Result] (graph)
+    a
+    b <- a
+`, n.Tree())
+
+	testutil.AssertEqual(t, `digraph workflow {
+  n0 [label="Pipeline[Result] (pipeline)", shape=folder];
+  n1 [label="fetch", shape=box];
+  n2 [label="parallel[Result] (parallel)", shape=folder];
+  n3 [label="firstStep", shape=box];
+  n4 [label="second", shape=box];
+  n5 [label="selector[Result] (select)", shape=folder];
+  n6 [label="deploy", shape=box];
+  n7 [label="Graph[Result] (graph)", shape=folder];
+  n8 [label="a", shape=box];
+  n9 [label="b", shape=box];
+  n0 -> n1;
+  n0 -> n2;
+  n2 -> n3;
+  n2 -> n4;
+  n0 -> n5;
+  n5 -> n6 [label="if"];
+  n0 -> n7;
+  n7 -> n8;
+  n7 -> n9;
+  n8 -> n9 [style=dashed];
+}
+`, n.DOT())
+
+	testutil.AssertEqual(t, `flowchart TD
+  n0["Pipeline[Result] (pipeline)"]
+  n1["fetch"]
+  n2["parallel[Result] (parallel)"]
+  n3["firstStep"]
+  n4["second"]
+  n5["selector[Result] (select)"]
+  n6["deploy"]
+  n7["Graph[Result] (graph)"]
+  n8["a"]
+  n9["b"]
+  n0 --> n1
+  n0 --> n2
+  n2 --> n3
+  n2 --> n4
+  n0 --> n5
+  n5 -->|if| n6
+  n0 --> n7
+  n7 --> n8
+  n7 --> n9
+  n8 -.-> n9
+`, n.Mermaid())
+}
+
+func TestDryRun(t *testing.T) {
+	var selected, wrapped int
+	always := func(ctx context.Context, r *Result) bool {
+		selected++
+		return true
+	}
+	mid := func(next wf.Step[Result]) wf.Step[Result] {
+		return wf.MidFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			wrapped++
+			return next.Run(ctx, r)
+		})
+	}
+	p := wf.NewPipeline[Result](mid)
+	p.Steps = []wf.Step[Result]{
+		wf.Named("fetch", message("fetch")),
+		wf.Select(nil, always, wf.Named("deploy", message("deploy")), nil),
+		wf.NewGraph[Result](nil, mergeMessages).
+			Add("a", message("a")).
+			Add("b", message("b"), "a"),
+	}
+
+	d := &wf.DryRun{}
+	ctx := wf.WithDryRun(context.Background(), d)
+	testutil.True(t, wf.IsDryRun(ctx), "context should be in dry-run mode")
+	res, err := p.Run(ctx, &Result{})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, 0, len(res.Messages))
+	testutil.AssertEqualSlice(t, []string{"fetch", "deploy", "a", "b"}, d.Steps())
+	testutil.AssertEqual(t, 1, selected)
+	testutil.AssertEqual(t, 3, wrapped)
+
+	t.Run("cache", func(t *testing.T) {
+		store := wf.NewMemoryCacheStore()
+		hash := func(ctx context.Context, r *Result) (string, error) {
+			return "h", nil
+		}
+		p := wf.NewPipeline[Result](wf.CacheMiddleware(store, hash, 0))
+		p.Steps = []wf.Step[Result]{wf.Named("cached", message("cached"))}
+		_, err := p.Run(wf.WithDryRun(context.Background(), nil), &Result{})
+		testutil.AssertNoError(t, err)
+		_, ok, err := store.Get(context.Background(), wf.CacheKey("cached", "h"))
+		testutil.AssertNoError(t, err)
+		testutil.False(t, ok, "dry run should not be cached")
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		inner := wf.NewPipeline[Result]()
+		inner.Steps = []wf.Step[Result]{
+			wf.Named("plan", message("plan")),
+			wf.Named("apply", message("apply")),
+		}
+		p := wf.NewPipeline[Result]()
+		p.Steps = []wf.Step[Result]{
+			wf.RetryMiddleware[Result](2, time.Millisecond, nil)(inner),
+			wf.Named("deploy", inner),
+		}
+		d := &wf.DryRun{}
+		res, err := p.Run(wf.WithDryRun(context.Background(), d), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 0, len(res.Messages))
+		testutil.AssertEqualSlice(
+			t,
+			[]string{"plan", "apply", "plan", "apply"},
+			d.Steps(),
+		)
+	})
+}
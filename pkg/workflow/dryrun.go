@@ -0,0 +1,72 @@
+package workflow
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// DryRun records the leaf steps which would have run in dry-run mode, see
+// [WithDryRun].
+type DryRun struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+// Steps returns the names of the leaf steps skipped in dry-run mode, in the
+// order they were reached.
+func (d *DryRun) Steps() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.steps)
+}
+
+func (d *DryRun) record(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.steps = append(d.steps, name)
+}
+
+// WithDryRun enables dry-run mode for the steps run with the context: the
+// middlewares and selectors are invoked, but the leaf steps (see [Describe])
+// are skipped and return their request unchanged.
+// The skipped steps are recorded in d, which can be nil.
+//
+// Middlewares with side effects can check [IsDryRun], e.g. [CacheMiddleware]
+// does not store results in dry-run mode.
+func WithDryRun(ctx context.Context, d *DryRun) context.Context {
+	if d == nil {
+		d = &DryRun{}
+	}
+	return context.WithValue(ctx, dryRunKey, d)
+}
+
+// IsDryRun reports whether the context is in dry-run mode, see [WithDryRun].
+func IsDryRun(ctx context.Context) bool {
+	_, ok := ctx.Value(dryRunKey).(*DryRun)
+	return ok
+}
+
+// wrap applies the middlewares to the step, the first middleware being the
+// outermost.
+// In dry-run mode, a leaf step is replaced by a step which only records it.
+func wrap[T any](ctx context.Context, s Step[T], mid Mid[T]) Step[T] {
+	if d, ok := ctx.Value(dryRunKey).(*DryRun); ok {
+		if Describe(s).Kind == KindStep {
+			leaf := Name(s)
+			s = MidFunc[T](func(ctx context.Context, req *T) (*T, error) {
+				name, err := GetStepName(ctx)
+				if err != nil {
+					name = leaf
+				}
+				d.record(name)
+				skipStep(ctx)
+				return req, nil
+			})
+		}
+	}
+	for _, m := range slices.Backward(mid) {
+		s = m(s)
+	}
+	return s
+}
@@ -0,0 +1,234 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Events
+//
+// An [EventBus] set in the context with [WithEventBus] receives an [Event]
+// each time a [Step] of a [Pipeline] starts and ends, and publishes it to its
+// subscribers, e.g. to display the progress or write an event log.
+
+// EventType is the type of an [Event].
+type EventType string
+
+const (
+	EventStepStarted  EventType = "step_started"
+	EventStepFinished EventType = "step_finished"
+	EventStepFailed   EventType = "step_failed"
+	// EventStepSkipped is published instead of [EventStepFinished] for the
+	// leaf steps skipped in dry-run mode, see [WithDryRun].
+	EventStepSkipped EventType = "step_skipped"
+)
+
+// Event reports a change in the state of a step.
+type Event struct {
+	Type EventType
+	// StepID is the ID of the step, as returned by [GetStepID].
+	StepID uuid.UUID
+	// ParentID is the ID of the step composed of this step, if any.
+	ParentID uuid.UUID
+	Name     string
+	Time     time.Time
+	// Duration is the duration of the step, once it ended.
+	Duration time.Duration
+	// Err is the error of a failed step.
+	Err error
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	var errMsg string
+	if e.Err != nil {
+		errMsg = e.Err.Error()
+	}
+	return json.Marshal(struct {
+		Type     EventType     `json:"type"`
+		StepID   uuid.UUID     `json:"step_id,omitzero"`
+		ParentID uuid.UUID     `json:"parent_id,omitzero"`
+		Name     string        `json:"name"`
+		Time     time.Time     `json:"time"`
+		Duration time.Duration `json:"duration,omitempty"`
+		Err      string        `json:"error,omitempty"`
+	}{
+		Type:     e.Type,
+		StepID:   e.StepID,
+		ParentID: e.ParentID,
+		Name:     e.Name,
+		Time:     e.Time,
+		Duration: e.Duration,
+		Err:      errMsg,
+	})
+}
+
+// EventHandler receives the events published by an [EventBus].
+// Handlers are called synchronously by the steps, so they must be quick and
+// safe for concurrent use.
+type EventHandler func(ctx context.Context, e Event)
+
+// EventBus publishes events to its subscribers.
+// It is safe for concurrent use.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[int]EventHandler
+	next     int
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: map[int]EventHandler{}}
+}
+
+// WithEventBus sets the bus receiving the events of the steps run with the
+// context.
+func WithEventBus(ctx context.Context, b *EventBus) context.Context {
+	return context.WithValue(ctx, eventBusKey, b)
+}
+
+// Subscribe calls the handler for each published event, until the returned
+// function is called.
+func (b *EventBus) Subscribe(h EventHandler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.handlers[id] = h
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Channel sends each published event to the returned channel, with the given
+// buffer size, until the returned function is called, which closes the
+// channel.
+// Publishing blocks while the buffer is full, unless the context of the step
+// is done or the channel is closed, in which case the event is dropped.
+func (b *EventBus) Channel(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+	done := make(chan struct{})
+	// The read lock is held while sending, so that the channel is not closed
+	// during a send.
+	var mu sync.RWMutex
+	closed := false
+	unsubscribe := b.Subscribe(func(ctx context.Context, e Event) {
+		mu.RLock()
+		defer mu.RUnlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- e:
+		case <-ctx.Done():
+		case <-done:
+		}
+	})
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			unsubscribe()
+			// Unblock the pending sends before waiting for them.
+			close(done)
+			mu.Lock()
+			defer mu.Unlock()
+			closed = true
+			close(ch)
+		})
+	}
+}
+
+// Publish sends the event to all the subscribers, in the order they
+// subscribed.
+// The handlers are called without holding the lock of the bus, so they can
+// subscribe and unsubscribe.
+func (b *EventBus) Publish(ctx context.Context, e Event) {
+	b.mu.RLock()
+	handlers := make([]EventHandler, 0, len(b.handlers))
+	for _, id := range slices.Sorted(maps.Keys(b.handlers)) {
+		handlers = append(handlers, b.handlers[id])
+	}
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(ctx, e)
+	}
+}
+
+// JSONEventHandler returns a handler writing the events to w as JSON lines,
+// one event per line, e.g. for an event log in CI.
+func JSONEventHandler(w io.Writer) EventHandler {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(ctx context.Context, e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(e); err != nil {
+			slog.WarnContext(ctx, "writing event", "step", e.Name, "err", err)
+		}
+	}
+}
+
+// stepRun is the state of a step run by runStep, shared with the steps it
+// wraps.
+type stepRun struct {
+	id      uuid.UUID
+	skipped bool
+}
+
+// publishStep publishes the events of a step run by runStep.
+// It returns the context for the step and a function to call when it ends.
+func publishStep(ctx context.Context, name string) (context.Context, func(error)) {
+	b, ok := ctx.Value(eventBusKey).(*EventBus)
+	if !ok {
+		return ctx, func(error) {}
+	}
+	id, _ := GetStepID(ctx)
+	var parentID uuid.UUID
+	if parent, ok := ctx.Value(stepRunKey).(*stepRun); ok {
+		parentID = parent.id
+	}
+	run := &stepRun{id: id}
+	ctx = context.WithValue(ctx, stepRunKey, run)
+
+	start := time.Now()
+	b.Publish(ctx, Event{
+		Type:     EventStepStarted,
+		StepID:   id,
+		ParentID: parentID,
+		Name:     name,
+		Time:     start,
+	})
+	return ctx, func(err error) {
+		e := Event{
+			Type:     EventStepFinished,
+			StepID:   id,
+			ParentID: parentID,
+			Name:     name,
+			Time:     time.Now(),
+			Err:      err,
+		}
+		e.Duration = e.Time.Sub(start)
+		switch {
+		case err != nil:
+			e.Type = EventStepFailed
+		case run.skipped:
+			e.Type = EventStepSkipped
+		}
+		b.Publish(ctx, e)
+	}
+}
+
+// skipStep marks the step run by runStep as skipped.
+func skipStep(ctx context.Context) {
+	if run, ok := ctx.Value(stepRunKey).(*stepRun); ok {
+		run.skipped = true
+	}
+}
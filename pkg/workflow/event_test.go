@@ -0,0 +1,165 @@
+package workflow_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := wf.NewEventBus()
+	var mu sync.Mutex
+	var events []wf.Event
+	unsubscribe := bus.Subscribe(func(ctx context.Context, e wf.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	ctx := wf.WithEventBus(context.Background(), bus)
+
+	p := wf.NewPipeline[Result]()
+	p.Steps = []wf.Step[Result]{wf.Series(nil, firstStep{}, failStep{})}
+	_, err := p.Run(ctx, &Result{})
+	testutil.AssertErrorMsg(t, err, "oops")
+
+	type summary struct {
+		Type wf.EventType
+		Name string
+	}
+	got := make([]summary, len(events))
+	for i, e := range events {
+		got[i] = summary{Type: e.Type, Name: e.Name}
+	}
+	testutil.AssertEqualSlice(t, []summary{
+		{wf.EventStepStarted, "series[Result]"},
+		{wf.EventStepStarted, "firstStep"},
+		{wf.EventStepFinished, "firstStep"},
+		{wf.EventStepStarted, "failStep"},
+		{wf.EventStepFailed, "failStep"},
+		{wf.EventStepFailed, "series[Result]"},
+	}, got)
+
+	series := events[0]
+	testutil.True(t, series.ParentID == [16]byte{}, "series should have no parent")
+	for _, e := range events[1:5] {
+		testutil.AssertEqual(t, series.StepID, e.ParentID)
+	}
+	testutil.True(t, events[1].StepID != events[3].StepID, "steps should have different IDs")
+	testutil.AssertErrorMsg(t, events[4].Err, "oops")
+
+	unsubscribe()
+	_, _ = p.Run(ctx, &Result{})
+	testutil.AssertEqual(t, 6, len(events))
+}
+
+func TestEventBusChannel(t *testing.T) {
+	bus := wf.NewEventBus()
+	ch, stop := bus.Channel(0)
+	var types []wf.EventType
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range ch {
+			types = append(types, e.Type)
+		}
+	}()
+
+	ctx := wf.WithEventBus(wf.WithDryRun(context.Background(), nil), bus)
+	p := wf.NewPipeline[Result]()
+	p.Steps = []wf.Step[Result]{firstStep{}}
+	_, err := p.Run(ctx, &Result{})
+	testutil.AssertNoError(t, err)
+	stop()
+	<-done
+	testutil.AssertEqualSlice(
+		t,
+		[]wf.EventType{wf.EventStepStarted, wf.EventStepSkipped},
+		types,
+	)
+}
+
+func TestEventBusChannelClose(t *testing.T) {
+	bus := wf.NewEventBus()
+	ch, stop := bus.Channel(0)
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		// Nobody receives, so the send blocks until the channel is closed.
+		bus.Publish(context.Background(), wf.Event{Name: "blocked"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		stop()
+	}()
+	for _, c := range []chan struct{}{stopped, published} {
+		select {
+		case <-c:
+		case <-time.After(time.Second):
+			t.Fatal("closing the channel should not deadlock")
+		}
+	}
+	_, ok := <-ch
+	testutil.False(t, ok, "channel should be closed")
+	// Publishing after closing is a no-op.
+	bus.Publish(context.Background(), wf.Event{Name: "late"})
+}
+
+func TestEventBusReentrant(t *testing.T) {
+	bus := wf.NewEventBus()
+	var names []string
+	var unsubscribe func()
+	unsubscribe = bus.Subscribe(func(ctx context.Context, e wf.Event) {
+		names = append(names, "first "+e.Name)
+		// Subscribing and unsubscribing from a handler does not deadlock.
+		unsubscribe()
+		bus.Subscribe(func(ctx context.Context, e wf.Event) {
+			names = append(names, "second "+e.Name)
+		})
+	})
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		bus.Publish(context.Background(), wf.Event{Name: "a"})
+		bus.Publish(context.Background(), wf.Event{Name: "b"})
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publishing should not deadlock")
+	}
+	testutil.AssertEqualSlice(t, []string{"first a", "second b"}, names)
+}
+
+func TestJSONEventHandler(t *testing.T) {
+	var b bytes.Buffer
+	bus := wf.NewEventBus()
+	bus.Subscribe(wf.JSONEventHandler(&b))
+	ctx := wf.WithEventBus(context.Background(), bus)
+
+	p := wf.NewPipeline[Result]()
+	p.Steps = []wf.Step[Result]{failStep{}}
+	_, _ = p.Run(ctx, &Result{})
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&b)
+	for scanner.Scan() {
+		var line map[string]any
+		testutil.AssertNoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	testutil.AssertEqual(t, 2, len(lines))
+	testutil.AssertEqual(t, "step_started", lines[0]["type"].(string))
+	testutil.AssertEqual(t, "step_failed", lines[1]["type"].(string))
+	testutil.AssertEqual(t, "failStep", lines[1]["name"].(string))
+	testutil.AssertEqual(t, "oops", lines[1]["error"].(string))
+}
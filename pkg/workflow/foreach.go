@@ -0,0 +1,103 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var _ Step[typ] = (*forEach[typ, string])(nil)
+
+// Items returns the items of the request to run a step for, see [ForEach].
+type Items[T, I any] func(context.Context, *T) ([]I, error)
+
+// Reducer folds the results of the items back into the request, see
+// [ForEach].
+type Reducer[T, I any] func(ctx context.Context, req *T, results []*I) (*T, error)
+
+type forEach[T, I any] struct {
+	items  Items[T, I]
+	step   Step[I]
+	reduce Reducer[T, I]
+	limit  int
+	Mid[I]
+}
+
+// ForEach runs the step for each item returned by items, concurrently, e.g.
+// to generate every provider or test every example.
+// The results are passed to reduce in the order of the items, to fold them
+// back into the request.
+// Each item is a copy, and the middlewares apply to the step of each item.
+//
+// The first failing item cancels the others, and its error is returned.
+func ForEach[T, I any](
+	mid Mid[I],
+	items Items[T, I],
+	step Step[I],
+	reduce Reducer[T, I],
+) *forEach[T, I] {
+	return &forEach[T, I]{
+		items:  items,
+		step:   step,
+		reduce: reduce,
+		Mid:    mid,
+	}
+}
+
+// Concurrency limits the number of items processed at the same time.
+// Zero or less means no limit, which is the default.
+func (f *forEach[T, I]) Concurrency(n int) *forEach[T, I] {
+	f.limit = n
+	return f
+}
+
+func (f *forEach[T, I]) String() string {
+	if f == nil {
+		return "none"
+	}
+	return fmt.Sprintf("ForEach{Step: %s}", Name(f.step))
+}
+
+func (f *forEach[T, I]) Run(ctx context.Context, req *T) (*T, error) {
+	items, err := f.items(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("getting items: %w", err)
+	}
+	name := Name(f.step)
+	g, groupCtx := errgroup.WithContext(ctx)
+	if f.limit > 0 {
+		g.SetLimit(f.limit)
+	}
+	results := make([]*I, len(items))
+	for i := range items {
+		g.Go(func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("item %d: panic: %v", i, r)
+				}
+			}()
+
+			item := items[i]
+			step := wrap(groupCtx, f.step, f.Mid)
+			resp, err := runStep(setStepID(groupCtx, gen.ID()), name, step, &item)
+			if err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+			results[i] = resp
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return f.reduce(ctx, req, results)
+}
+
+func (f *forEach[T, I]) describe() *Node {
+	return &Node{
+		Name:     Name[T](f),
+		Kind:     KindForEach,
+		Children: []*Node{Describe(f.step)},
+	}
+}
@@ -0,0 +1,92 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+type examples struct {
+	Dirs    []string
+	Results []string
+}
+
+func exampleDirs(ctx context.Context, e *examples) ([]string, error) {
+	return e.Dirs, nil
+}
+
+func collect(ctx context.Context, e *examples, results []*string) (*examples, error) {
+	for _, r := range results {
+		e.Results = append(e.Results, *r)
+	}
+	return e, nil
+}
+
+func TestForEach(t *testing.T) {
+	var running, peak atomic.Int32
+	test := wf.StepFunc[string](func(ctx context.Context, dir *string) (*string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// Later items finish first, the results must still be in order.
+		time.Sleep(time.Duration(5-len(*dir)) * 5 * time.Millisecond)
+		res := "tested " + *dir
+		return &res, nil
+	})
+
+	f := wf.ForEach(nil, exampleDirs, wf.Step[string](test), collect).Concurrency(2)
+	res, err := f.Run(context.Background(), &examples{Dirs: []string{"a", "bb", "ccc", "dddd"}})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqualSlice(t, []string{
+		"tested a",
+		"tested bb",
+		"tested ccc",
+		"tested dddd",
+	}, res.Results)
+	testutil.True(t, peak.Load() <= 2, "at most 2 items should run at once")
+
+	t.Run("error", func(t *testing.T) {
+		fail := wf.StepFunc[string](func(ctx context.Context, dir *string) (*string, error) {
+			if strings.HasPrefix(*dir, "b") {
+				return nil, errors.New("broken")
+			}
+			return dir, nil
+		})
+		f := wf.ForEach(nil, exampleDirs, wf.Step[string](fail), collect)
+		_, err := f.Run(context.Background(), &examples{Dirs: []string{"a", "b"}})
+		testutil.AssertErrorMsg(t, err, "item 1: broken")
+	})
+
+	t.Run("items error", func(t *testing.T) {
+		items := func(ctx context.Context, e *examples) ([]string, error) {
+			return nil, errors.New("no dirs")
+		}
+		f := wf.ForEach(nil, items, wf.Step[string](test), collect)
+		_, err := f.Run(context.Background(), &examples{})
+		testutil.AssertErrorMsg(t, err, "getting items: no dirs")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		res, err := f.Run(context.Background(), &examples{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 0, len(res.Results))
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		f := wf.ForEach(nil, exampleDirs, wf.Named("test", wf.Step[string](test)), collect)
+		testutil.AssertEqual(t, `forEach[examples,string] (foreach)
+  test
+`, wf.Describe[examples](f).Tree())
+	})
+}
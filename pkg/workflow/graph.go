@@ -0,0 +1,279 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	ErrGraphCycle         = errors.New("graph has a cycle")
+	ErrGraphDuplicateNode = errors.New("duplicate graph node")
+	ErrGraphUnknownNode   = errors.New("unknown graph node")
+	ErrGraphNilResponse   = errors.New("nil response")
+)
+
+var _ Step[typ] = (*Graph[typ])(nil)
+
+// Graph executes steps as a directed acyclic graph (DAG), where each node runs
+// once all the nodes it depends on are done.
+// Nodes which are ready run concurrently, up to the limit set with
+// [Graph.Concurrency].
+//
+// A node without dependencies receives a copy of the request.
+// A node with one dependency receives a copy of the result of the dependency,
+// and a node with several dependencies receives their results combined with
+// the [MergeRequest].
+// The result of the graph is the results of the nodes nothing depends on,
+// combined the same way.
+type Graph[T any] struct {
+	merge MergeRequest[T]
+	nodes []graphNode[T]
+	limit int
+	Mid[T]
+}
+
+type graphNode[T any] struct {
+	name string
+	step Step[T]
+	deps []string
+}
+
+// NewGraph creates an empty graph, where the results of several nodes are
+// combined with merge.
+func NewGraph[T any](mid Mid[T], merge MergeRequest[T]) *Graph[T] {
+	return &Graph[T]{
+		merge: merge,
+		Mid:   mid,
+	}
+}
+
+// Add adds a node which runs the step after the nodes named in deps.
+// Nodes can be added in any order, the graph is validated when it runs or is
+// planned.
+func (g *Graph[T]) Add(name string, step Step[T], deps ...string) *Graph[T] {
+	g.nodes = append(g.nodes, graphNode[T]{name: name, step: step, deps: deps})
+	return g
+}
+
+// Concurrency limits the number of nodes running at the same time.
+// Zero or less means no limit, which is the default.
+func (g *Graph[T]) Concurrency(n int) *Graph[T] {
+	g.limit = n
+	return g
+}
+
+func (g *Graph[T]) String() string {
+	if g == nil {
+		return "none"
+	}
+	nn := make([]string, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		if len(n.deps) == 0 {
+			nn = append(nn, n.name)
+			continue
+		}
+		nn = append(nn, fmt.Sprintf("%s <- %s", n.name, strings.Join(n.deps, "+")))
+	}
+	return fmt.Sprintf("Graph{Nodes: [%s]}", strings.Join(nn, ", "))
+}
+
+// Plan returns the planned order of the nodes, as stages of node names.
+// All nodes of a stage can run concurrently, once the previous stages are
+// done.
+// Within a stage, the nodes are in the order they were added.
+// It returns an error if the graph is not valid, e.g. if it has a cycle.
+func (g *Graph[T]) Plan() ([][]string, error) {
+	index, err := g.index()
+	if err != nil {
+		return nil, err
+	}
+	pending, dependents := g.edges(index)
+	var stages [][]string
+	var ready []int
+	for i := range g.nodes {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	planned := 0
+	for len(ready) > 0 {
+		stage := make([]string, len(ready))
+		var next []int
+		for j, i := range ready {
+			stage[j] = g.nodes[i].name
+			for _, d := range dependents[i] {
+				pending[d]--
+				if pending[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		slices.Sort(next)
+		stages = append(stages, stage)
+		planned += len(ready)
+		ready = next
+	}
+	if planned < len(g.nodes) {
+		var cycle []string
+		for i, n := range g.nodes {
+			if pending[i] > 0 {
+				cycle = append(cycle, n.name)
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrGraphCycle, strings.Join(cycle, ", "))
+	}
+	return stages, nil
+}
+
+// index returns the index of each node by name, validating the nodes.
+func (g *Graph[T]) index() (map[string]int, error) {
+	index := make(map[string]int, len(g.nodes))
+	for i, n := range g.nodes {
+		if _, ok := index[n.name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrGraphDuplicateNode, n.name)
+		}
+		index[n.name] = i
+	}
+	for _, n := range g.nodes {
+		for _, d := range n.deps {
+			if _, ok := index[d]; !ok {
+				return nil, fmt.Errorf(
+					"%w: %s depends on %s", ErrGraphUnknownNode, n.name, d,
+				)
+			}
+		}
+	}
+	return index, nil
+}
+
+// edges returns the number of dependencies of each node, and the nodes
+// depending on each node.
+func (g *Graph[T]) edges(index map[string]int) ([]int, [][]int) {
+	pending := make([]int, len(g.nodes))
+	dependents := make([][]int, len(g.nodes))
+	for i, n := range g.nodes {
+		for _, d := range n.deps {
+			pending[i]++
+			dependents[index[d]] = append(dependents[index[d]], i)
+		}
+	}
+	return pending, dependents
+}
+
+func (g *Graph[T]) Run(ctx context.Context, req *T) (*T, error) {
+	if _, err := g.Plan(); err != nil {
+		return nil, err
+	}
+	index, _ := g.index()
+	pending, dependents := g.edges(index)
+
+	tasks := make([]Step[T], len(g.nodes))
+	for i, n := range g.nodes {
+		tasks[i] = wrap(ctx, n.step, g.Mid)
+	}
+
+	eg, groupCtx := errgroup.WithContext(ctx)
+	if g.limit > 0 {
+		eg.SetLimit(g.limit)
+	}
+	resps := make([]*T, len(g.nodes))
+	// Buffered so that finished nodes never block, even when the scheduler
+	// is blocked waiting for a free slot.
+	done := make(chan int, len(g.nodes))
+	launch := func(i int) {
+		eg.Go(func() (err error) {
+			// A panicking node must fail the graph, otherwise its
+			// dependents would wait forever.
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("graph node %s: panic: %v", g.nodes[i].name, r)
+				}
+			}()
+
+			input, err := g.input(groupCtx, req, resps, index, g.nodes[i].deps)
+			if err != nil {
+				return err
+			}
+			resp, err := runStep(
+				setStepID(groupCtx, gen.ID()),
+				g.nodes[i].name,
+				tasks[i],
+				input,
+			)
+			if err != nil {
+				return fmt.Errorf("graph node %s: %w", g.nodes[i].name, err)
+			}
+			// Dependents and the final merge copy the response, so it must
+			// not be nil.
+			if resp == nil {
+				return fmt.Errorf("graph node %s: %w", g.nodes[i].name, ErrGraphNilResponse)
+			}
+			resps[i] = resp
+			done <- i
+			return nil
+		})
+	}
+	for i := range g.nodes {
+		if pending[i] == 0 {
+			launch(i)
+		}
+	}
+schedule:
+	for range g.nodes {
+		select {
+		case i := <-done:
+			for _, d := range dependents[i] {
+				pending[d]--
+				if pending[d] == 0 {
+					launch(d)
+				}
+			}
+		case <-groupCtx.Done():
+			break schedule
+		}
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("aborting: %w", err)
+	}
+
+	var sinks []string
+	for i, n := range g.nodes {
+		if len(dependents[i]) == 0 {
+			sinks = append(sinks, n.name)
+		}
+	}
+	return g.input(ctx, req, resps, index, sinks)
+}
+
+// input combines the results of the named nodes, or copies the request if
+// there are none.
+func (g *Graph[T]) input(
+	ctx context.Context,
+	req *T,
+	resps []*T,
+	index map[string]int,
+	names []string,
+) (*T, error) {
+	input := new(T)
+	if len(names) == 0 {
+		*input = *req
+		return input, nil
+	}
+	*input = *resps[index[names[0]]]
+	if len(names) == 1 {
+		return input, nil
+	}
+	rest := make([]*T, 0, len(names)-1)
+	for _, name := range names[1:] {
+		rest = append(rest, resps[index[name]])
+	}
+	return g.merge(ctx, input, rest...)
+}
@@ -0,0 +1,176 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+// mergeMessages combines the messages of the results, without duplicates.
+func mergeMessages(
+	ctx context.Context,
+	req *Result,
+	responses ...*Result,
+) (*Result, error) {
+	msgs := slices.Clone(req.Messages)
+	for _, r := range responses {
+		if r == nil {
+			continue
+		}
+		for _, m := range r.Messages {
+			if !slices.Contains(msgs, m) {
+				msgs = append(msgs, m)
+			}
+		}
+	}
+	req.Messages = msgs
+	return req, nil
+}
+
+func message(msg string) wf.Step[Result] {
+	return wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		r.Messages = append(slices.Clone(r.Messages), msg)
+		return r, nil
+	})
+}
+
+func TestGraphPlan(t *testing.T) {
+	g := wf.NewGraph[Result](nil, mergeMessages).
+		Add("c", message("c"), "a", "b").
+		Add("d", message("d"), "a").
+		Add("a", message("a")).
+		Add("b", message("b")).
+		Add("e", message("e"), "c", "d")
+	stages, err := g.Plan()
+	testutil.AssertNoError(t, err)
+	if diff := testutil.Diff(stages, [][]string{
+		{"a", "b"},
+		{"c", "d"},
+		{"e"},
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+
+	t.Run("cycle", func(t *testing.T) {
+		g := wf.NewGraph[Result](nil, mergeMessages).
+			Add("a", message("a")).
+			Add("b", message("b"), "a", "c").
+			Add("c", message("c"), "b")
+		_, err := g.Plan()
+		testutil.ErrorIs(t, err, wf.ErrGraphCycle)
+		testutil.AssertErrorMsg(t, err, "graph has a cycle: b, c")
+		_, err = g.Run(context.Background(), &Result{})
+		testutil.ErrorIs(t, err, wf.ErrGraphCycle)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		g := wf.NewGraph[Result](nil, mergeMessages).
+			Add("a", message("a"), "z")
+		_, err := g.Plan()
+		testutil.AssertErrorMsg(t, err, "unknown graph node: a depends on z")
+	})
+	t.Run("duplicate", func(t *testing.T) {
+		g := wf.NewGraph[Result](nil, mergeMessages).
+			Add("a", message("a")).
+			Add("a", message("a"))
+		_, err := g.Plan()
+		testutil.ErrorIs(t, err, wf.ErrGraphDuplicateNode)
+	})
+}
+
+func TestGraphRun(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(msg string) wf.Step[Result] {
+		return wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			mu.Lock()
+			order = append(order, msg)
+			mu.Unlock()
+			r.Messages = append(slices.Clone(r.Messages), msg)
+			return r, nil
+		})
+	}
+	g := wf.NewGraph[Result](nil, mergeMessages).
+		Add("a", record("a")).
+		Add("b", record("b")).
+		Add("c", record("c"), "a", "b").
+		Add("d", record("d"), "a")
+	got, err := g.Run(context.Background(), &Result{Messages: []string{"start"}})
+	testutil.AssertNoError(t, err)
+
+	// The sinks are c and d, which both include the messages of a.
+	testutil.AssertEqual(t, 5, len(got.Messages))
+	testutil.AssertEqual(t, "start", got.Messages[0])
+	for _, m := range []string{"a", "b", "c", "d"} {
+		testutil.Contains(t, got.Messages, m)
+	}
+	pos := func(m string) int { return slices.Index(order, m) }
+	testutil.True(t, pos("a") < pos("c"), "a runs before c")
+	testutil.True(t, pos("b") < pos("c"), "b runs before c")
+	testutil.True(t, pos("a") < pos("d"), "a runs before d")
+}
+
+func TestGraphConcurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	step := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return r, nil
+	})
+	g := wf.NewGraph[Result](nil, mergeMessages).Concurrency(2)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		g.Add(name, step)
+	}
+	_, err := g.Run(context.Background(), &Result{})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, int32(2), maxRunning.Load())
+}
+
+func TestGraphError(t *testing.T) {
+	var ran atomic.Bool
+	g := wf.NewGraph[Result](nil, mergeMessages).
+		Add("a", wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			return nil, errors.New("oops")
+		})).
+		Add("b", wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			ran.Store(true)
+			return r, nil
+		}), "a")
+	_, err := g.Run(context.Background(), &Result{})
+	testutil.AssertErrorMsg(t, err, "graph node a: oops")
+	testutil.False(t, ran.Load(), "b should not run when a fails")
+
+	t.Run("panic", func(t *testing.T) {
+		g := wf.NewGraph[Result](nil, mergeMessages).
+			Add("a", wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+				panic("boom")
+			})).
+			Add("b", message("b"), "a")
+		_, err := g.Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(t, err, "graph node a: panic: boom")
+	})
+
+	t.Run("nil response", func(t *testing.T) {
+		g := wf.NewGraph[Result](nil, mergeMessages).
+			Add("a", message("a")).
+			Add("b", wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+				return nil, nil
+			}), "a")
+		_, err := g.Run(context.Background(), &Result{})
+		testutil.ErrorIs(t, err, wf.ErrGraphNilResponse)
+		testutil.AssertErrorMsg(t, err, "graph node b: nil response")
+	})
+}
@@ -0,0 +1,116 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrLoopMaxIterations = errors.New("loop reached max iterations")
+
+var _ Step[typ] = (*loop[typ])(nil)
+
+// Predicate reports whether a condition holds for the request.
+type Predicate[T any] func(context.Context, *T) bool
+
+type loop[T any] struct {
+	step Step[T]
+	cond Predicate[T]
+	// while checks the condition before each iteration and stops when it
+	// does not hold, otherwise the condition is checked after each iteration
+	// and the loop stops when it holds.
+	while    bool
+	maxIter  int
+	interval time.Duration
+	Mid[T]
+}
+
+// Loop runs the step repeatedly, until the predicate holds for its result,
+// e.g. to poll a cluster until it is ready.
+// The step runs at least once, and the result of each iteration is the
+// request of the next one.
+// If the predicate does not hold after maxIter iterations, it returns the last
+// result with an error wrapping [ErrLoopMaxIterations]. Zero or less means no
+// limit.
+//
+// In dry-run mode (see [WithDryRun]), the step runs once.
+func Loop[T any](mid Mid[T], step Step[T], until Predicate[T], maxIter int) *loop[T] {
+	return &loop[T]{
+		step:    step,
+		cond:    until,
+		maxIter: maxIter,
+		Mid:     mid,
+	}
+}
+
+// While runs the step repeatedly, as long as the predicate holds for the
+// request, which is checked before each iteration. The step does not run if
+// the predicate does not hold at first.
+// Otherwise it behaves like [Loop].
+func While[T any](mid Mid[T], cond Predicate[T], step Step[T], maxIter int) *loop[T] {
+	return &loop[T]{
+		step:    step,
+		cond:    cond,
+		while:   true,
+		maxIter: maxIter,
+		Mid:     mid,
+	}
+}
+
+// Interval sets the time to wait between iterations, e.g. between polls.
+func (l *loop[T]) Interval(d time.Duration) *loop[T] {
+	l.interval = d
+	return l
+}
+
+func (l *loop[T]) String() string {
+	if l == nil {
+		return "none"
+	}
+	return fmt.Sprintf("Loop{Step: %s, Max: %d}", Name(l.step), l.maxIter)
+}
+
+func (l *loop[T]) Run(ctx context.Context, req *T) (*T, error) {
+	name := Name(l.step)
+	for i := 0; l.maxIter <= 0 || i < l.maxIter; i++ {
+		if l.while && !l.cond(ctx, req) {
+			return req, nil
+		}
+		if i > 0 && l.interval > 0 {
+			select {
+			case <-ctx.Done():
+				return req, fmt.Errorf("aborting: %w", ctx.Err())
+			case <-time.After(l.interval):
+			}
+		}
+		resp, err := runStep(setStepID(ctx, gen.ID()), name, wrap(ctx, l.step, l.Mid), req)
+		if err != nil {
+			return resp, err
+		}
+		req = resp
+		// The result of a dry run does not change, so the loop would not
+		// end.
+		if IsDryRun(ctx) {
+			return req, nil
+		}
+		if !l.while && l.cond(ctx, req) {
+			return req, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return req, fmt.Errorf("aborting: %w", err)
+		}
+	}
+	if l.while && !l.cond(ctx, req) {
+		return req, nil
+	}
+	return req, fmt.Errorf("%w: %d", ErrLoopMaxIterations, l.maxIter)
+}
+
+func (l *loop[T]) describe() *Node {
+	return &Node{
+		Name:     Name[T](l),
+		Kind:     KindLoop,
+		Children: []*Node{Describe(l.step)},
+	}
+}
@@ -0,0 +1,230 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Built-in middlewares, usable with any step composing other steps, i.e.
+// [Pipeline], [Series], [Parallel], [Select] and [Graph].
+//
+// Middlewares with state (rate limit and circuit breaker) share it between all
+// the steps they wrap, so create one middleware per resource to protect.
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// RetryMiddleware retries a failing step up to attempts times in total,
+// waiting backoff before the first retry and doubling it for each subsequent
+// retry.
+// Each attempt receives a copy of the original request.
+//
+// The retryable function decides whether an error should be retried.
+// If it is nil, all errors are retried except context cancellation and
+// [ErrCircuitOpen].
+func RetryMiddleware[T any](
+	attempts int,
+	backoff time.Duration,
+	retryable func(error) bool,
+) Middleware[T] {
+	if retryable == nil {
+		retryable = isRetryable
+	}
+	return func(next Step[T]) Step[T] {
+		return wrapStep(next, func(ctx context.Context, req *T) (*T, error) {
+			wait := backoff
+			for attempt := 1; ; attempt++ {
+				copyReq := new(T)
+				*copyReq = *req
+				resp, err := next.Run(ctx, copyReq)
+				if err == nil || attempt >= attempts || !retryable(err) {
+					return resp, err
+				}
+				select {
+				case <-ctx.Done():
+					return resp, errors.Join(err, ctx.Err())
+				case <-time.After(wait):
+				}
+				wait *= 2
+			}
+		})
+	}
+}
+
+// midStep is a step wrapped by a built-in middleware. It keeps the name and
+// the description of the wrapped step, so that e.g. a wrapped [Pipeline] is
+// not taken for a leaf step in dry-run mode.
+type midStep[T any] struct {
+	MidFunc[T]
+	next Step[T]
+}
+
+func wrapStep[T any](next Step[T], f MidFunc[T]) Step[T] {
+	return &midStep[T]{MidFunc: f, next: next}
+}
+
+func (m *midStep[T]) StepName() string {
+	return Name(m.next)
+}
+
+func (m *midStep[T]) Unwrap() Step[T] {
+	return m.next
+}
+
+func isRetryable(err error) bool {
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, ErrCircuitOpen)
+}
+
+// TimeoutMiddleware sets a deadline of d for each step.
+// Steps must honour the context to be interrupted, but a step which finishes
+// after its deadline fails even if it ignored the context.
+func TimeoutMiddleware[T any](d time.Duration) Middleware[T] {
+	return func(next Step[T]) Step[T] {
+		return wrapStep(next, func(ctx context.Context, req *T) (*T, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			resp, err := next.Run(ctx, req)
+			if err == nil && ctx.Err() != nil {
+				return resp, fmt.Errorf("step %s: %w", Name(next), ctx.Err())
+			}
+			return resp, err
+		})
+	}
+}
+
+// RateLimitMiddleware limits how often the wrapped steps start, to one every
+// interval on average, allowing bursts of up to burst steps.
+// Steps wait for their turn, unless the context is done.
+func RateLimitMiddleware[T any](interval time.Duration, burst int) Middleware[T] {
+	l := newRateLimiter(interval, burst)
+	return func(next Step[T]) Step[T] {
+		return wrapStep(next, func(ctx context.Context, req *T) (*T, error) {
+			if err := l.wait(ctx); err != nil {
+				return nil, fmt.Errorf("rate limit: %w", err)
+			}
+			return next.Run(ctx, req)
+		})
+	}
+}
+
+// rateLimiter is a token bucket, refilled with one token every interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	burst = max(burst, 1)
+	return &rateLimiter{
+		interval: interval,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// wait takes a token, waiting until one is available.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.interval > 0 {
+		l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	} else {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// Take the token now, even if it is not available yet, so that waiting
+	// steps are served in order.
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens * float64(l.interval))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		// Give the token back.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// CircuitBreakerMiddleware stops running the wrapped steps after threshold
+// consecutive failures, failing fast with [ErrCircuitOpen] instead.
+// After cooldown, one step is let through: if it succeeds the circuit closes
+// again, otherwise it stays open for another cooldown.
+// A panicking step counts as a failure, and the panic is propagated.
+func CircuitBreakerMiddleware[T any](
+	threshold int,
+	cooldown time.Duration,
+) Middleware[T] {
+	b := &circuitBreaker{threshold: max(threshold, 1), cooldown: cooldown}
+	return func(next Step[T]) Step[T] {
+		return wrapStep(next, func(ctx context.Context, req *T) (*T, error) {
+			if !b.allow() {
+				return nil, fmt.Errorf("step %s: %w", Name(next), ErrCircuitOpen)
+			}
+			// A panic counts as a failure, and must not leave a trial
+			// running forever.
+			failed := true
+			defer func() { b.record(failed) }()
+			resp, err := next.Run(ctx, req)
+			failed = err != nil
+			return resp, err
+		})
+	}
+}
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	// trial is set while a step is let through to test a half-open circuit.
+	trial bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
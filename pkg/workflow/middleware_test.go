@@ -0,0 +1,158 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+// failing returns a step which fails the first failures times it runs.
+func failing(failures int, runs *int) wf.Step[Result] {
+	return wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		*runs++
+		r.State.Counter++
+		if *runs <= failures {
+			return nil, errors.New("transient")
+		}
+		return r, nil
+	})
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	ctx := context.Background()
+	t.Run("retried", func(t *testing.T) {
+		var runs int
+		mid := wf.Mid[Result]{wf.RetryMiddleware[Result](3, time.Millisecond, nil)}
+		got, err := wf.Series(mid, failing(2, &runs)).Run(ctx, &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 3, runs)
+		// Each attempt gets a copy of the original request.
+		testutil.AssertEqual(t, 1, got.State.Counter)
+	})
+	t.Run("exhausted", func(t *testing.T) {
+		var runs int
+		mid := wf.Mid[Result]{wf.RetryMiddleware[Result](2, time.Millisecond, nil)}
+		_, err := wf.Series(mid, failing(5, &runs)).Run(ctx, &Result{})
+		testutil.AssertErrorMsg(t, err, "transient")
+		testutil.AssertEqual(t, 2, runs)
+	})
+	t.Run("not retryable", func(t *testing.T) {
+		var runs int
+		mid := wf.Mid[Result]{wf.RetryMiddleware[Result](
+			3,
+			time.Millisecond,
+			func(err error) bool { return false },
+		)}
+		_, err := wf.Series(mid, failing(5, &runs)).Run(ctx, &Result{})
+		testutil.AssertErrorMsg(t, err, "transient")
+		testutil.AssertEqual(t, 1, runs)
+	})
+}
+
+type sleepStep struct{ d time.Duration }
+
+func (s sleepStep) Run(ctx context.Context, r *Result) (*Result, error) {
+	time.Sleep(s.d)
+	return r, nil
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	mid := wf.Mid[Result]{wf.TimeoutMiddleware[Result](time.Millisecond)}
+	_, err := wf.Series(mid, sleepStep{d: 10 * time.Millisecond}).
+		Run(context.Background(), &Result{})
+	testutil.ErrorIs(t, err, context.DeadlineExceeded)
+	testutil.AssertErrorMsg(t, err, "step sleepStep: context deadline exceeded")
+
+	_, err = wf.Series(mid, sleepStep{}).Run(context.Background(), &Result{})
+	testutil.AssertNoError(t, err)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	interval := 20 * time.Millisecond
+	mid := wf.Mid[Result]{wf.RateLimitMiddleware[Result](interval, 2)}
+	steps := make([]wf.Step[Result], 4)
+	for i := range steps {
+		steps[i] = sleepStep{}
+	}
+	start := time.Now()
+	_, err := wf.Parallel(mid, wf.Merge[Result], steps...).
+		Run(context.Background(), &Result{})
+	testutil.AssertNoError(t, err)
+	// Two steps run immediately, the other two wait one and two intervals.
+	elapsed := time.Since(start)
+	testutil.True(t, elapsed >= 2*interval, "steps should be rate limited")
+
+	t.Run("canceled", func(t *testing.T) {
+		mid := wf.Mid[Result]{wf.RateLimitMiddleware[Result](time.Hour, 1)}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, err := wf.Series(mid, sleepStep{}, sleepStep{}).Run(ctx, &Result{})
+		testutil.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	ctx := context.Background()
+	cooldown := 10 * time.Millisecond
+	mid := wf.Mid[Result]{wf.CircuitBreakerMiddleware[Result](2, cooldown)}
+	var runs int
+	step := wf.Series(mid, failing(3, &runs))
+
+	for range 2 {
+		_, err := step.Run(ctx, &Result{})
+		testutil.AssertErrorMsg(t, err, "transient")
+	}
+	// The circuit is open, so the step does not run.
+	_, err := step.Run(ctx, &Result{})
+	testutil.ErrorIs(t, err, wf.ErrCircuitOpen)
+	testutil.AssertEqual(t, 2, runs)
+
+	// After the cooldown, one trial runs and fails, opening the circuit again.
+	time.Sleep(cooldown)
+	_, err = step.Run(ctx, &Result{})
+	testutil.AssertErrorMsg(t, err, "transient")
+	_, err = step.Run(ctx, &Result{})
+	testutil.ErrorIs(t, err, wf.ErrCircuitOpen)
+
+	// The next trial succeeds and closes the circuit.
+	time.Sleep(cooldown)
+	_, err = step.Run(ctx, &Result{})
+	testutil.AssertNoError(t, err)
+	_, err = step.Run(ctx, &Result{})
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, 5, runs)
+
+	t.Run("panic", func(t *testing.T) {
+		breaker := wf.CircuitBreakerMiddleware[Result](1, cooldown)
+		var runs int
+		step := breaker(wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			runs++
+			panic("boom")
+		}))
+		run := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			_, err = step.Run(ctx, &Result{})
+			return err
+		}
+		testutil.AssertErrorMsg(t, run(), "panic: boom")
+		testutil.ErrorIs(t, run(), wf.ErrCircuitOpen)
+
+		// The panicking trial fails, but lets the next trial run after the
+		// cooldown.
+		for range 2 {
+			time.Sleep(cooldown)
+			testutil.AssertErrorMsg(t, run(), "panic: boom")
+			testutil.ErrorIs(t, run(), wf.ErrCircuitOpen)
+		}
+		testutil.AssertEqual(t, 3, runs)
+	})
+}
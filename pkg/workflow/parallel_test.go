@@ -0,0 +1,159 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+func failWith(msg string) wf.Step[Result] {
+	return wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		return nil, errors.New(msg)
+	})
+}
+
+// waitCancel returns a step which records whether it was cancelled.
+func waitCancel(cancelled *atomic.Bool) wf.Step[Result] {
+	return wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		select {
+		case <-ctx.Done():
+			cancelled.Store(true)
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+			r.Messages = append(slices.Clone(r.Messages), "slow")
+			return r, nil
+		}
+	})
+}
+
+func TestParallelPolicy(t *testing.T) {
+	t.Run("fail fast", func(t *testing.T) {
+		var cancelled atomic.Bool
+		p := wf.Parallel(nil, mergeMessages, failWith("boom"), waitCancel(&cancelled))
+		_, err := p.Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(t, err, "boom")
+		testutil.True(t, cancelled.Load(), "sibling should be cancelled")
+	})
+
+	t.Run("wait all", func(t *testing.T) {
+		var cancelled atomic.Bool
+		p := wf.Parallel(
+			nil,
+			mergeMessages,
+			failWith("boom"),
+			waitCancel(&cancelled),
+			failWith("bang"),
+		).Policy(wf.WaitAll)
+		_, err := p.Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(
+			t,
+			err,
+			"task 0 (StepFunc[Result]): boom\ntask 2 (StepFunc[Result]): bang",
+		)
+		testutil.False(t, cancelled.Load(), "sibling should not be cancelled")
+	})
+
+	t.Run("wait all succeeds", func(t *testing.T) {
+		p := wf.Parallel(nil, mergeMessages, message("a"), message("b")).
+			Policy(wf.WaitAll)
+		res, err := p.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"a", "b"}, res.Messages)
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		var taskErrs wf.TaskErrors
+		var merged []*Result
+		merge := func(ctx context.Context, req *Result, resps ...*Result) (*Result, error) {
+			var err error
+			taskErrs, err = wf.GetTaskErrors(ctx)
+			if err != nil {
+				return nil, err
+			}
+			merged = resps
+			return mergeMessages(ctx, req, resps...)
+		}
+		p := wf.Parallel(
+			nil,
+			merge,
+			message("a"),
+			failWith("boom"),
+			message("c"),
+		).Policy(wf.BestEffort)
+		res, err := p.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"a", "c"}, res.Messages)
+		testutil.AssertEqual(t, 1, len(taskErrs))
+		testutil.AssertErrorMsg(t, taskErrs[1], "boom")
+		// The responses are aligned with the tasks, so the index of an error
+		// is the index of the missing response.
+		testutil.AssertEqual(t, 3, len(merged))
+		testutil.True(t, merged[1] == nil, "failed task should have no response")
+		testutil.AssertEqualSlice(t, []string{"c"}, merged[2].Messages)
+	})
+
+	t.Run("best effort merge", func(t *testing.T) {
+		p := wf.Parallel(
+			nil,
+			wf.Merge[Result],
+			failWith("boom"),
+			message("b"),
+		).Policy(wf.BestEffort)
+		res, err := p.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"b"}, res.Messages)
+	})
+
+	t.Run("best effort all failed", func(t *testing.T) {
+		p := wf.Parallel(nil, mergeMessages, failWith("boom"), failWith("bang")).
+			Policy(wf.BestEffort)
+		_, err := p.Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(
+			t,
+			err,
+			"task 0 (StepFunc[Result]): boom\ntask 1 (StepFunc[Result]): bang",
+		)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		panicking := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			panic("oops")
+		})
+		p := wf.Parallel(nil, mergeMessages, message("a"), panicking).
+			Policy(wf.BestEffort)
+		res, err := p.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"a"}, res.Messages)
+	})
+}
+
+func TestParallelConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	step := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return r, nil
+	})
+	steps := make([]wf.Step[Result], 10)
+	for i := range steps {
+		steps[i] = step
+	}
+	p := wf.Parallel(nil, mergeMessages, steps...).Concurrency(3)
+	_, err := p.Run(context.Background(), &Result{})
+	testutil.AssertNoError(t, err)
+	testutil.True(t, peak.Load() <= 3, "at most 3 tasks should run at once")
+	testutil.True(t, peak.Load() > 1, "tasks should run concurrently")
+}
@@ -0,0 +1,137 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Compensator is implemented by steps which can undo their side effects, e.g.
+// steps created with [Compensable].
+// In saga mode (see [Saga] and [Pipeline.Saga]), when a step fails, the
+// completed steps are compensated in reverse order.
+// The compensator of a wrapped step is found with [AsStep].
+type Compensator[T any] interface {
+	// Compensate undoes the step, given the result it returned.
+	Compensate(ctx context.Context, resp *T) error
+}
+
+var _ Compensator[typ] = (*compensable[typ])(nil)
+
+type compensable[T any] struct {
+	Step[T]
+	compensate func(context.Context, *T) error
+}
+
+// Compensable adds a compensating action to the step, which undoes it when a
+// later step of a saga fails.
+func Compensable[T any](
+	s Step[T],
+	compensate func(ctx context.Context, resp *T) error,
+) Step[T] {
+	return &compensable[T]{Step: s, compensate: compensate}
+}
+
+func (c *compensable[T]) Compensate(ctx context.Context, resp *T) error {
+	return c.compensate(ctx, resp)
+}
+
+func (c *compensable[T]) StepName() string {
+	return Name(c.Step)
+}
+
+func (c *compensable[T]) Unwrap() Step[T] {
+	return c.Step
+}
+
+// completedStep is a step which completed in a saga, with its result.
+type completedStep[T any] struct {
+	name string
+	c    Compensator[T]
+	resp *T
+}
+
+// compensate runs the compensations of the completed steps in reverse order,
+// joining the error which caused it with any compensation errors.
+// Compensations run even if the context is canceled, as undoing the side
+// effects matters most when the saga was interrupted.
+func compensate[T any](
+	ctx context.Context,
+	cause error,
+	completed []completedStep[T],
+) error {
+	ctx = context.WithoutCancel(ctx)
+	errs := []error{cause}
+	for _, s := range slices.Backward(completed) {
+		if err := s.c.Compensate(ctx, s.resp); err != nil {
+			errs = append(errs, fmt.Errorf("compensating %s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var _ Step[typ] = (*saga[typ])(nil)
+
+type saga[T any] struct {
+	Steps []Step[T]
+	Mid[T]
+}
+
+// Saga executes steps in sequential order, like [Series], but if a step fails
+// or the context is canceled, the steps which completed are compensated in
+// reverse order (see [Compensator]).
+// The returned error joins the failure with any compensation errors.
+func Saga[T any](mid Mid[T], steps ...Step[T]) *saga[T] {
+	return &saga[T]{
+		Steps: steps,
+		Mid:   mid,
+	}
+}
+
+func (s *saga[T]) String() string {
+	if s == nil {
+		return "none"
+	}
+	return fmt.Sprintf("Saga{Steps: %d}", len(s.Steps))
+}
+
+func (s *saga[T]) Run(ctx context.Context, req *T) (*T, error) {
+	return runSaga(ctx, s.Steps, s.Mid, req)
+}
+
+// runSaga runs the steps in saga mode.
+func runSaga[T any](
+	ctx context.Context,
+	steps []Step[T],
+	mid Mid[T],
+	req *T,
+) (*T, error) {
+	var completed []completedStep[T]
+	resp := req
+	for i := range steps {
+		if err := ctx.Err(); err != nil {
+			return resp, compensate(
+				ctx,
+				fmt.Errorf("aborting: %w", err),
+				completed,
+			)
+		}
+		step := wrap(ctx, steps[i], mid)
+		name := Name(steps[i])
+		var err error
+		resp, err = runStep(setStepID(ctx, gen.ID()), name, step, req)
+		if err != nil {
+			return resp, compensate(ctx, err, completed)
+		}
+		if c, ok := AsStep[Compensator[T]](steps[i]); ok {
+			completed = append(completed, completedStep[T]{
+				name: name,
+				c:    c,
+				resp: resp,
+			})
+		}
+		req = resp
+	}
+	return resp, nil
+}
@@ -0,0 +1,114 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+func TestSaga(t *testing.T) {
+	var calls []string
+	step := func(name string, err error) wf.Step[Result] {
+		return wf.Compensable(
+			wf.Named(name, wf.Step[Result](wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+				calls = append(calls, "run "+name)
+				if err != nil {
+					return nil, err
+				}
+				r.State.Counter++
+				return r, nil
+			}))),
+			func(ctx context.Context, r *Result) error {
+				calls = append(calls, "compensate "+name)
+				if name == "b" {
+					return errors.New("b stuck")
+				}
+				return nil
+			},
+		)
+	}
+	// A step without compensation.
+	plain := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		calls = append(calls, "run plain")
+		return r, nil
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		calls = nil
+		_, err := wf.Saga(
+			nil,
+			step("a", nil),
+			plain,
+			step("b", nil),
+			step("c", errors.New("c failed")),
+			step("d", nil),
+		).Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(t, err, "c failed\ncompensating b: b stuck")
+		testutil.AssertEqualSlice(t, []string{
+			"run a",
+			"run plain",
+			"run b",
+			"run c",
+			"compensate b",
+			"compensate a",
+		}, calls)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		calls = nil
+		p := wf.NewPipeline[Result]()
+		p.Saga = true
+		p.Steps = []wf.Step[Result]{step("a", nil), step("b", nil)}
+		got, err := p.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 2, got.State.Counter)
+		testutil.AssertEqualSlice(t, []string{"run a", "run b"}, calls)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		calls = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelStep := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			cancel()
+			return r, nil
+		})
+		p := wf.NewPipeline[Result]()
+		p.Saga = true
+		p.Steps = []wf.Step[Result]{step("a", nil), cancelStep, step("c", nil)}
+		_, err := p.Run(ctx, &Result{})
+		testutil.ErrorIs(t, err, context.Canceled)
+		testutil.AssertEqualSlice(t, []string{"run a", "compensate a"}, calls)
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		calls = nil
+		fail := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			return nil, errors.New("failed")
+		})
+		_, err := wf.Saga(
+			nil,
+			wf.Named("x", step("a", nil)),
+			&logged{Step: step("b", nil)},
+			fail,
+		).Run(context.Background(), &Result{})
+		testutil.AssertErrorMsg(t, err, "failed\ncompensating logged: b stuck")
+		testutil.AssertEqualSlice(t, []string{
+			"run a",
+			"run b",
+			"compensate b",
+			"compensate a",
+		}, calls)
+	})
+}
+
+// logged wraps a step, like a middleware would.
+type logged struct {
+	wf.Step[Result]
+}
+
+func (l *logged) Unwrap() wf.Step[Result] {
+	return l.Step
+}
@@ -0,0 +1,103 @@
+package workflow
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrSwitchNoBranch = errors.New("switch has no branch")
+
+var _ Step[typ] = (*switchStep[typ, string])(nil)
+
+// SwitchKey returns the key of the branch to run for the request.
+type SwitchKey[T any, K comparable] func(context.Context, *T) K
+
+type switchStep[T any, K comparable] struct {
+	key      SwitchKey[T, K]
+	branches map[K]Step[T]
+	def      Step[T]
+	Mid[T]
+}
+
+// Switch runs the branch of the key returned by key, like a switch statement,
+// or the default step def if there is no branch for the key.
+// The default step can be nil, in which case a missing branch is an error
+// wrapping [ErrSwitchNoBranch].
+// Unlike [Select], which chooses between two steps, a switch has any number of
+// branches, e.g. one per environment.
+func Switch[T any, K comparable](
+	mid Mid[T],
+	key SwitchKey[T, K],
+	branches map[K]Step[T],
+	def Step[T],
+) *switchStep[T, K] {
+	return &switchStep[T, K]{
+		key:      key,
+		branches: branches,
+		def:      def,
+		Mid:      mid,
+	}
+}
+
+func (s *switchStep[T, K]) String() string {
+	if s == nil {
+		return "none"
+	}
+	bb := make([]string, 0, len(s.branches)+1)
+	for _, b := range s.sortedBranches() {
+		bb = append(bb, fmt.Sprintf("%s: %s", b.label, Name(b.step)))
+	}
+	if s.def != nil {
+		bb = append(bb, "default: "+Name(s.def))
+	}
+	return fmt.Sprintf("Switch{Branches: [%s]}", strings.Join(bb, ", "))
+}
+
+type switchBranch[T any] struct {
+	label string
+	step  Step[T]
+}
+
+// sortedBranches returns the branches sorted by the text of their key, so
+// that they are listed in the same order each time.
+func (s *switchStep[T, K]) sortedBranches() []switchBranch[T] {
+	bb := make([]switchBranch[T], 0, len(s.branches))
+	for k, step := range s.branches {
+		bb = append(bb, switchBranch[T]{label: fmt.Sprint(k), step: step})
+	}
+	slices.SortFunc(bb, func(a, b switchBranch[T]) int {
+		return cmp.Compare(a.label, b.label)
+	})
+	return bb
+}
+
+func (s *switchStep[T, K]) Run(ctx context.Context, req *T) (*T, error) {
+	k := s.key(ctx, req)
+	step, ok := s.branches[k]
+	if !ok {
+		step = s.def
+	}
+	if step == nil {
+		return nil, fmt.Errorf("%w: %v", ErrSwitchNoBranch, k)
+	}
+	return runStep(setStepID(ctx, gen.ID()), Name(step), wrap(ctx, step, s.Mid), req)
+}
+
+func (s *switchStep[T, K]) describe() *Node {
+	n := &Node{Name: Name[T](s), Kind: KindSwitch}
+	for _, b := range s.sortedBranches() {
+		child := Describe(b.step)
+		child.Label = b.label
+		n.Children = append(n.Children, child)
+	}
+	if s.def != nil {
+		child := Describe(s.def)
+		child.Label = "default"
+		n.Children = append(n.Children, child)
+	}
+	return n
+}
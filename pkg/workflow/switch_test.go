@@ -0,0 +1,127 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+type env string
+
+const (
+	envDev  env = "dev"
+	envProd env = "prod"
+	envTest env = "test"
+)
+
+func TestSwitch(t *testing.T) {
+	var current env
+	key := func(ctx context.Context, r *Result) env { return current }
+	branches := map[env]wf.Step[Result]{
+		envDev:  wf.Named("deploy-dev", message("dev")),
+		envProd: wf.Named("deploy-prod", message("prod")),
+	}
+
+	s := wf.Switch(nil, key, branches, wf.Named("skip", message("default")))
+	for _, tt := range []struct {
+		env  env
+		want string
+	}{
+		{envDev, "dev"},
+		{envProd, "prod"},
+		{envTest, "default"},
+	} {
+		current = tt.env
+		res, err := s.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{tt.want}, res.Messages)
+	}
+
+	t.Run("no default", func(t *testing.T) {
+		current = envTest
+		s := wf.Switch(nil, key, branches, nil)
+		_, err := s.Run(context.Background(), &Result{})
+		testutil.ErrorIs(t, err, wf.ErrSwitchNoBranch)
+		testutil.AssertErrorMsg(t, err, "switch has no branch: test")
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		testutil.AssertEqual(t, `deploy (switch)
+  dev: deploy-dev
+  prod: deploy-prod
+  default: skip
+`, wf.Describe(wf.Named[Result]("deploy", s)).Tree())
+	})
+}
+
+func TestLoop(t *testing.T) {
+	poll := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+		r.State.Counter++
+		return r, nil
+	})
+	ready := func(n int) wf.Predicate[Result] {
+		return func(ctx context.Context, r *Result) bool {
+			return r.State.Counter >= n
+		}
+	}
+
+	t.Run("until", func(t *testing.T) {
+		l := wf.Loop(nil, poll, ready(3), 5).Interval(time.Millisecond)
+		res, err := l.Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 3, res.State.Counter)
+	})
+
+	t.Run("runs at least once", func(t *testing.T) {
+		res, err := wf.Loop(nil, poll, ready(0), 5).Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 1, res.State.Counter)
+	})
+
+	t.Run("max iterations", func(t *testing.T) {
+		res, err := wf.Loop(nil, poll, ready(10), 4).Run(context.Background(), &Result{})
+		testutil.ErrorIs(t, err, wf.ErrLoopMaxIterations)
+		testutil.AssertEqual(t, 4, res.State.Counter)
+	})
+
+	t.Run("while", func(t *testing.T) {
+		below := func(n int) wf.Predicate[Result] {
+			return func(ctx context.Context, r *Result) bool {
+				return r.State.Counter < n
+			}
+		}
+		res, err := wf.While(nil, below(3), poll, 0).Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 3, res.State.Counter)
+
+		res, err = wf.While(nil, below(0), poll, 0).Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 0, res.State.Counter)
+
+		res, err = wf.While(nil, below(3), poll, 3).Run(context.Background(), &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, 3, res.State.Counter)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelling := wf.StepFunc[Result](func(ctx context.Context, r *Result) (*Result, error) {
+			cancel()
+			return r, nil
+		})
+		_, err := wf.Loop(nil, cancelling, ready(1), 0).Interval(time.Hour).Run(ctx, &Result{})
+		testutil.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		d := &wf.DryRun{}
+		ctx := wf.WithDryRun(context.Background(), d)
+		_, err := wf.Loop(nil, wf.Named("poll", wf.Step[Result](poll)), ready(3), 0).
+			Run(ctx, &Result{})
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqualSlice(t, []string{"poll"}, d.Steps())
+	})
+}
@@ -0,0 +1,216 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tracing
+//
+// A trace is a tree of [Span], each timing an operation such as a [Step] of a
+// [Pipeline]. Spans are only recorded when a [Tracer] is set in the context
+// with [WithTracer], and finished spans are sent to its [SpanExporter].
+
+// SpanData is the record of a finished [Span].
+type SpanData struct {
+	TraceID  uuid.UUID      `json:"trace_id"`
+	ID       uuid.UUID      `json:"id"`
+	ParentID uuid.UUID      `json:"parent_id,omitzero"`
+	Name     string         `json:"name"`
+	Start    time.Time      `json:"start"`
+	End      time.Time      `json:"end"`
+	Duration time.Duration  `json:"duration"`
+	Attrs    map[string]any `json:"attrs,omitempty"`
+	Err      string         `json:"error,omitempty"`
+}
+
+// SpanExporter receives the spans when they end, e.g. to write them to a file
+// or send them to a tracing backend.
+// It must be safe for concurrent use.
+type SpanExporter interface {
+	ExportSpan(ctx context.Context, span SpanData) error
+}
+
+// Tracer starts spans and sends them to its exporter when they end.
+type Tracer struct {
+	exp SpanExporter
+}
+
+func NewTracer(exp SpanExporter) *Tracer {
+	return &Tracer{exp: exp}
+}
+
+// WithTracer sets the tracer used by [StartSpan] for the context.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, spanKey, &Span{tracer: t})
+}
+
+// Span is a timed operation of a trace.
+// A nil Span is valid and records nothing, so callers do not need to check
+// whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// StartSpan starts a span, which is a child of the span in the context (if
+// any), and returns a context containing the new span.
+// If the context has no [Tracer], the returned span is nil.
+// The span must be ended with [Span.End].
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent, ok := ctx.Value(spanKey).(*Span)
+	if !ok || parent.tracer == nil {
+		return ctx, nil
+	}
+	// Span IDs do not use the step ID generator, so that tracing does not
+	// change the step IDs.
+	id := uuid.Must(uuid.NewV7())
+	s := &Span{
+		tracer: parent.tracer,
+		data: SpanData{
+			TraceID:  parent.data.TraceID,
+			ID:       id,
+			ParentID: parent.data.ID,
+			Name:     name,
+			Start:    time.Now(),
+		},
+	}
+	// A span without a parent starts a new trace.
+	if s.data.TraceID == uuid.Nil {
+		s.data.TraceID = id
+	}
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// SpanFromContext returns the current span of the context, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, ok := ctx.Value(spanKey).(*Span)
+	if !ok || s.data.ID == uuid.Nil {
+		return nil
+	}
+	return s
+}
+
+// SetAttr sets an attribute of the span, e.g. the name of an action.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attrs == nil {
+		s.data.Attrs = map[string]any{}
+	}
+	s.data.Attrs[key] = value
+}
+
+// End ends the span, recording the error (if any), and exports it.
+// Only the first call has any effect.
+func (s *Span) End(ctx context.Context, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.Duration = s.data.End.Sub(s.data.Start)
+	if err != nil {
+		s.data.Err = err.Error()
+	}
+	data := s.data
+	s.mu.Unlock()
+
+	if err := s.tracer.exp.ExportSpan(ctx, data); err != nil {
+		slog.WarnContext(ctx, "exporting span", "span", data.Name, "err", err)
+	}
+}
+
+// runStep runs the step in a span, if tracing is enabled, and publishes its
+// events, if an [EventBus] is set.
+func runStep[T any](ctx context.Context, name string, s Step[T], req *T) (*T, error) {
+	ctx = setStepName(ctx, name)
+	ctx, span := StartSpan(ctx, name)
+	if id, err := GetStepID(ctx); err == nil {
+		span.SetAttr("step_id", id.String())
+	}
+	ctx, end := publishStep(ctx, name)
+	resp, err := s.Run(ctx, req)
+	end(err)
+	span.End(ctx, err)
+	return resp, err
+}
+
+// Exporters
+
+var (
+	_ SpanExporter = (*JSONFileExporter)(nil)
+	_ SpanExporter = (*SpanRecorder)(nil)
+)
+
+// JSONFileExporter writes spans to a file as JSON lines, one span per line.
+type JSONFileExporter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewJSONFileExporter creates the file at path, truncating it if it exists.
+// The exporter must be closed with [JSONFileExporter.Close].
+func NewJSONFileExporter(path string) (*JSONFileExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating trace directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating trace file: %w", err)
+	}
+	return &JSONFileExporter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (e *JSONFileExporter) ExportSpan(_ context.Context, span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(span)
+}
+
+// Close closes the file.
+func (e *JSONFileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
+
+// SpanRecorder keeps the spans in memory, e.g. for tests.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *SpanRecorder) ExportSpan(_ context.Context, span SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+	return nil
+}
+
+// Spans returns the recorded spans, in the order they ended.
+func (r *SpanRecorder) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.spans)
+}
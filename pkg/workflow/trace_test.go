@@ -0,0 +1,110 @@
+package workflow_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/testutil"
+	wf "github.com/golingon/lingon/pkg/workflow"
+)
+
+type firstStep struct{}
+
+func (firstStep) Run(ctx context.Context, r *Result) (*Result, error) {
+	r.Messages = append(r.Messages, "first")
+	return r, nil
+}
+
+type failStep struct{}
+
+func (failStep) Run(ctx context.Context, r *Result) (*Result, error) {
+	_, span := wf.StartSpan(ctx, "inner")
+	span.SetAttr("attempt", 1)
+	span.End(ctx, nil)
+	return r, errors.New("oops")
+}
+
+func TestTrace(t *testing.T) {
+	rec := &wf.SpanRecorder{}
+	ctx := wf.WithTracer(context.Background(), wf.NewTracer(rec))
+	ctx, root := wf.StartSpan(ctx, "root")
+
+	p := wf.NewPipeline[Result]()
+	p.Steps = []wf.Step[Result]{
+		wf.Series(nil, firstStep{}, failStep{}),
+	}
+	_, err := p.Run(ctx, &Result{})
+	testutil.AssertErrorMsg(t, err, "oops")
+	root.End(ctx, err)
+
+	spans := rec.Spans()
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	testutil.AssertEqualSlice(t, []string{
+		"firstStep",
+		"inner",
+		"failStep",
+		"series[Result]",
+		"root",
+	}, names)
+
+	rootData := spans[4]
+	testutil.AssertEqual(t, rootData.ID, rootData.TraceID)
+	for _, s := range spans {
+		testutil.AssertEqual(t, rootData.TraceID, s.TraceID)
+	}
+	// Spans are nested as the steps.
+	testutil.AssertEqual(t, rootData.ID, spans[3].ParentID)
+	testutil.AssertEqual(t, spans[3].ID, spans[2].ParentID)
+	testutil.AssertEqual(t, spans[3].ID, spans[0].ParentID)
+	testutil.AssertEqual(t, spans[2].ID, spans[1].ParentID)
+
+	testutil.AssertEqual(t, "oops", spans[2].Err)
+	testutil.AssertEqual(t, "", spans[0].Err)
+	testutil.AssertEqual[any](t, 1, spans[1].Attrs["attempt"])
+	_, ok := spans[0].Attrs["step_id"]
+	testutil.True(t, ok, "step span should have a step_id attribute")
+}
+
+func TestTraceDisabled(t *testing.T) {
+	ctx, span := wf.StartSpan(context.Background(), "root")
+	testutil.True(t, span == nil, "span should be nil without a tracer")
+	// A nil span is valid.
+	span.SetAttr("key", "value")
+	span.End(ctx, nil)
+	testutil.True(t, wf.SpanFromContext(ctx) == nil, "context should have no span")
+}
+
+func TestJSONFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "trace.json")
+	exp, err := wf.NewJSONFileExporter(path)
+	testutil.AssertNoError(t, err)
+	ctx := wf.WithTracer(context.Background(), wf.NewTracer(exp))
+	for _, name := range []string{"export", "plan"} {
+		_, span := wf.StartSpan(ctx, name)
+		span.SetAttr("action_name", "network")
+		span.End(ctx, nil)
+	}
+	testutil.AssertNoError(t, exp.Close())
+
+	f, err := os.Open(path)
+	testutil.AssertNoError(t, err)
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span wf.SpanData
+		testutil.AssertNoError(t, json.Unmarshal(scanner.Bytes(), &span))
+		testutil.AssertEqual[any](t, "network", span.Attrs["action_name"])
+		names = append(names, span.Name)
+	}
+	testutil.AssertNoError(t, scanner.Err())
+	testutil.AssertEqualSlice(t, []string{"export", "plan"}, names)
+}
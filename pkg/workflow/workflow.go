@@ -2,10 +2,10 @@ package workflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"reflect"
-	"slices"
 	"strings"
 
 	"dario.cat/mergo"
@@ -16,13 +16,24 @@ type Step[T any] interface {
 	Run(context.Context, *T) (*T, error)
 }
 
+// StepNamer is implemented by steps which have a name, e.g. steps created
+// with [Named].
+type StepNamer interface {
+	StepName() string
+}
+
 func Name[T any](s Step[T]) string {
+	if n, ok := s.(StepNamer); ok {
+		return n.StepName()
+	}
 	t := reflect.TypeOf(s)
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 	var z [0]T // zero alloc
-	return strings.Replace(t.Name(), reflect.TypeOf(z).Elem().PkgPath()+".", "", 1)
+	// Every type argument from the package of T is shortened, e.g. the key of
+	// a [Switch].
+	return strings.ReplaceAll(t.Name(), reflect.TypeOf(z).Elem().PkgPath()+".", "")
 }
 
 type typ struct{}
@@ -38,22 +49,65 @@ var (
 type Pipeline[T any] struct {
 	Steps []Step[T]
 	Mid[T]
+	// Saga enables saga mode: if a step fails or the context is canceled,
+	// the steps which completed are compensated in reverse order, see
+	// [Saga].
+	Saga bool
+	// Checkpoint enables checkpointing: the result is stored after each
+	// successful step, and a failed run is resumed at the first incomplete
+	// step, see [Checkpoint].
+	Checkpoint *Checkpoint
 }
 
 func (p *Pipeline[T]) Run(ctx context.Context, req *T) (*T, error) {
+	if p.Saga {
+		if p.Checkpoint != nil {
+			return nil, ErrCheckpointSaga
+		}
+		return runSaga(ctx, p.Steps, p.Mid, req)
+	}
+	names := make([]string, len(p.Steps))
+	for i, s := range p.Steps {
+		names[i] = Name(s)
+	}
+	start := 0
+	// A dry run neither resumes nor stores checkpoints.
+	checkpoint := p.Checkpoint
+	if IsDryRun(ctx) {
+		checkpoint = nil
+	}
+	var ckptSteps []string
+	if checkpoint != nil {
+		ckptSteps = checkpointSteps(p.Steps)
+		var err error
+		start, req, err = resume(checkpoint, ckptSteps, req)
+		if err != nil {
+			return nil, err
+		}
+	}
 	resp := req
 	var err error
-	for i := range p.Steps {
-		for _, m := range slices.Backward(p.Mid) {
-			p.Steps[i] = m(p.Steps[i])
-		}
+	for i := start; i < len(p.Steps); i++ {
+		// Wrap a copy of the step, so that middlewares are not applied again
+		// each time the pipeline runs.
+		step := wrap(ctx, p.Steps[i], p.Mid)
 		ctx = setStepID(ctx, gen.ID())
-		resp, err = p.Steps[i].Run(ctx, req)
+		resp, err = runStep(ctx, names[i], step, req)
 		if err != nil {
 			return nil, err
 		}
+		if checkpoint != nil {
+			if err := checkpoint.save(ckptSteps[:i+1], resp); err != nil {
+				return nil, err
+			}
+		}
 		req = resp
 	}
+	if checkpoint != nil {
+		if err := checkpoint.Reset(); err != nil {
+			return nil, fmt.Errorf("removing checkpoint: %w", err)
+		}
+	}
 	return resp, nil
 }
 
@@ -64,6 +118,49 @@ func NewPipeline[T any](mid ...Middleware[T]) *Pipeline[T] {
 	}
 }
 
+// Named
+
+type named[T any] struct {
+	name string
+	Step[T]
+}
+
+// Named gives a name to the step, e.g. for tracing and caching.
+func Named[T any](name string, s Step[T]) Step[T] {
+	return &named[T]{name: name, Step: s}
+}
+
+func (n *named[T]) StepName() string {
+	return n.name
+}
+
+func (n *named[T]) String() string {
+	return n.name
+}
+
+func (n *named[T]) Unwrap() Step[T] {
+	return n.Step
+}
+
+// AsStep finds the first step in the chain of wrapped steps which implements
+// I, e.g. the [Compensator] of a step given a name with [Named].
+// Steps which wrap another step, e.g. in a [Middleware], should implement
+// `Unwrap() Step[T]` so that it can be found.
+func AsStep[I, T any](s Step[T]) (I, bool) {
+	for s != nil {
+		if i, ok := s.(I); ok {
+			return i, true
+		}
+		u, ok := s.(interface{ Unwrap() Step[T] })
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+	var z I
+	return z, false
+}
+
 // StepFunc
 
 type StepFunc[T any] func(context.Context, *T) (*T, error)
@@ -125,10 +222,7 @@ func (s selector[T]) Run(ctx context.Context, r *T) (*T, error) {
 	if step == nil {
 		return nil, fmt.Errorf("selector chosed missing else branch: %v", r)
 	}
-	for _, m := range slices.Backward(s.Mid) {
-		step = m(step)
-	}
-	return step.Run(setStepID(ctx, gen.ID()), r)
+	return runStep(setStepID(ctx, gen.ID()), Name(step), wrap(ctx, step, s.Mid), r)
 }
 
 // Series
@@ -162,11 +256,9 @@ func (s *series[T]) Run(ctx context.Context, req *T) (*T, error) {
 	resp := req
 
 	for i := range s.Stages {
-		for _, m := range slices.Backward(s.Mid) {
-			s.Stages[i] = m(s.Stages[i])
-		}
+		step := wrap(ctx, s.Stages[i], s.Mid)
 		ctx = setStepID(ctx, gen.ID())
-		resp, err = s.Stages[i].Run(ctx, req)
+		resp, err = runStep(ctx, Name(s.Stages[i]), step, req)
 		if err != nil {
 			return resp, err
 		}
@@ -178,11 +270,47 @@ func (s *series[T]) Run(ctx context.Context, req *T) (*T, error) {
 // Parallel
 
 type parallel[T any] struct {
-	merge MergeRequest[T]
-	Tasks []Step[T]
+	merge  MergeRequest[T]
+	Tasks  []Step[T]
+	policy ParallelPolicy
+	limit  int
 	Mid[T]
 }
 
+// ParallelPolicy decides how [Parallel] handles failing tasks.
+type ParallelPolicy int
+
+const (
+	// FailFast cancels the other tasks on the first failure and returns its
+	// error. It is the default.
+	FailFast ParallelPolicy = iota
+	// WaitAll waits for all the tasks and returns their errors joined, if
+	// any failed.
+	WaitAll
+	// BestEffort waits for all the tasks and merges the responses of the
+	// tasks which succeeded.
+	// The responses are passed to the merge function in the order of the
+	// tasks, with nil for the tasks which failed, so that the index of a
+	// response is the index of its task in [TaskErrors]. Their errors are
+	// available to the merge function with [GetTaskErrors].
+	// It fails only if all the tasks failed.
+	BestEffort
+)
+
+// TaskErrors are the errors of the failed tasks of [Parallel], by the index
+// of the task.
+type TaskErrors map[int]error
+
+// GetTaskErrors returns the errors of the failed tasks, in the context passed
+// to the merge function of [Parallel] with the [BestEffort] policy.
+func GetTaskErrors(ctx context.Context) (TaskErrors, error) {
+	v, ok := ctx.Value(taskErrorsKey).(TaskErrors)
+	if !ok {
+		return nil, ErrMissingFromContext
+	}
+	return v, nil
+}
+
 func (p *parallel[T]) String() string {
 	if p == nil {
 		return "none"
@@ -206,23 +334,49 @@ func Parallel[T any](mid Mid[T], merge MergeRequest[T], steps ...Step[T]) *paral
 	}
 }
 
+// Policy sets how failing tasks are handled, see [ParallelPolicy].
+func (p *parallel[T]) Policy(policy ParallelPolicy) *parallel[T] {
+	p.policy = policy
+	return p
+}
+
+// Concurrency limits the number of tasks running at the same time, e.g. for
+// large fan-outs.
+// Zero or less means no limit, which is the default.
+func (p *parallel[T]) Concurrency(n int) *parallel[T] {
+	p.limit = n
+	return p
+}
+
 func (p *parallel[T]) Run(ctx context.Context, req *T) (*T, error) {
 	tasks := make([]Step[T], len(p.Tasks))
+	names := make([]string, len(p.Tasks))
 	for i, s := range p.Tasks {
-		tasks[i] = s
-		for _, m := range slices.Backward(p.Mid) {
-			tasks[i] = m(tasks[i])
-		}
+		tasks[i] = wrap(ctx, s, p.Mid)
+		names[i] = Name(s)
+	}
+	g, groupCtx := &errgroup.Group{}, ctx
+	// Only fail fast cancels the other tasks on failure.
+	if p.policy == FailFast {
+		g, groupCtx = errgroup.WithContext(ctx)
+	}
+	if p.limit > 0 {
+		g.SetLimit(p.limit)
 	}
-	g, groupCtx := errgroup.WithContext(ctx)
 	resps := make([]*T, len(p.Tasks))
+	errs := make([]error, len(p.Tasks))
 	for i := range tasks {
-		g.Go(func() error {
-			defer CapturePanic(groupCtx)
+		g.Go(func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+				errs[i] = err
+			}()
 
 			copyReq := new(T)
 			*copyReq = *req
-			resp, err := tasks[i].Run(setStepID(groupCtx, gen.ID()), copyReq)
+			resp, err := runStep(setStepID(groupCtx, gen.ID()), names[i], tasks[i], copyReq)
 			if err != nil {
 				return err
 			}
@@ -230,16 +384,53 @@ func (p *parallel[T]) Run(ctx context.Context, req *T) (*T, error) {
 			return nil
 		})
 	}
-	if err := g.Wait(); err != nil {
-		return nil, err
+	err := g.Wait()
+
+	switch p.policy {
+	case WaitAll:
+		if err != nil {
+			return nil, joinTaskErrors(names, errs)
+		}
+	case BestEffort:
+		taskErrs := TaskErrors{}
+		for i, err := range errs {
+			if err != nil {
+				taskErrs[i] = err
+				resps[i] = nil
+			}
+		}
+		if len(taskErrs) > 0 && len(taskErrs) == len(errs) {
+			return nil, joinTaskErrors(names, errs)
+		}
+		return p.merge(context.WithValue(ctx, taskErrorsKey, taskErrs), req, resps...)
+	default:
+		if err != nil {
+			return nil, err
+		}
 	}
 	return p.merge(ctx, req, resps...)
 }
 
+func joinTaskErrors(names []string, errs []error) error {
+	joined := make([]error, 0, len(errs))
+	for i, err := range errs {
+		if err != nil {
+			joined = append(joined, fmt.Errorf("task %d (%s): %w", i, names[i], err))
+		}
+	}
+	return errors.Join(joined...)
+}
+
+// MergeTransform returns a [MergeRequest] merging the responses into the
+// request with [mergo.Merge] and the given options.
+// Nil responses, e.g. of the failed tasks of [BestEffort], are skipped.
 func MergeTransform[T any](t ...func(*mergo.Config)) MergeRequest[T] {
 	return func(ctx context.Context, res *T, responses ...*T) (*T, error) {
 		var err error
 		for _, r := range responses {
+			if r == nil {
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				return nil, fmt.Errorf("aborting: %w", ctx.Err())
@@ -36,6 +36,17 @@ func (r *Result) String() string {
 	return fmt.Sprintf("Result{State: %#v, Messages: %v}", r.State, r.Messages)
 }
 
+func TestName(t *testing.T) {
+	key := func(ctx context.Context, r *Result) env { return envDev }
+	testutil.AssertEqual(t, "firstStep", wf.Name[Result](firstStep{}))
+	testutil.AssertEqual(t, "named", wf.Name(wf.Named[Result]("named", firstStep{})))
+	testutil.AssertEqual(
+		t,
+		"switchStep[Result,env]",
+		wf.Name[Result](wf.Switch[Result, env](nil, key, nil, nil)),
+	)
+}
+
 func TestEmptyPipeline(t *testing.T) {
 	p := wf.NewPipeline[Result]()
 	_, err := p.Run(context.Background(), &Result{})
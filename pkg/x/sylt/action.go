@@ -41,4 +41,13 @@ type ActionType string
 type RunOpts struct {
 	DryRun  bool
 	Destroy bool
+	// Drift runs the action in drift detection mode.
+	// Actions should compare the desired state with the actual state and
+	// record the result, without making any changes.
+	// See [DriftDetector].
+	// [RunOpts.DryRun] is always set along with Drift.
+	Drift bool
+	// Approver, if set, must approve changes before an action applies them.
+	// See [WithWorkflowApprover].
+	Approver Approver
 }
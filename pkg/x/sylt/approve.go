@@ -0,0 +1,163 @@
+package sylt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrApplyAborted = errors.New("apply aborted")
+	// ErrDestroySkipped is returned by the cleanup of an action when the
+	// [Approver] skipped the destroy, so the resources are still live.
+	ErrDestroySkipped = errors.New("destroy skipped")
+)
+
+// Decision is the answer of an [Approver] to an [ApprovalRequest].
+type Decision int
+
+const (
+	// DecisionApprove applies the changes.
+	DecisionApprove Decision = 1
+	// DecisionSkip skips applying the changes of the action, and continues the
+	// workflow.
+	DecisionSkip Decision = 2
+	// DecisionAbort stops the workflow with [ErrApplyAborted].
+	DecisionAbort Decision = 3
+)
+
+func (d Decision) String() string {
+	switch d {
+	case DecisionApprove:
+		return "approve"
+	case DecisionSkip:
+		return "skip"
+	case DecisionAbort:
+		return "abort"
+	default:
+		return fmt.Sprintf("Decision(%d)", int(d))
+	}
+}
+
+// ApprovalRequest asks to approve the changes of an action before they are
+// applied.
+type ApprovalRequest struct {
+	ActionName string
+	ActionType ActionType
+	// Destroy is true if the changes destroy the action's resources.
+	Destroy bool
+	// Plan summarises the planned changes.
+	Plan PlanSummary
+	// Changes contains the addresses of the resources with changes.
+	Changes []string
+	// Prune contains the resources to remove from the state, if the request
+	// is for pruning the state (see [WithTerraPrune]).
+	Prune []StateResource
+}
+
+// Approver approves the changes of actions before they are applied, e.g. by
+// prompting in a terminal ([TerminalApprover]) or asking in a chat.
+// Use [WithWorkflowApprover] to set the approver for a workflow.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) (Decision, error)
+}
+
+// ApproverFunc is a function implementing [Approver].
+type ApproverFunc func(ctx context.Context, req ApprovalRequest) (Decision, error)
+
+func (f ApproverFunc) Approve(
+	ctx context.Context,
+	req ApprovalRequest,
+) (Decision, error) {
+	return f(ctx, req)
+}
+
+// TerminalApprover returns an [Approver] which shows the plan summary on out
+// and reads the decision from in, e.g. [os.Stdin] and [os.Stdout].
+// Reaching the end of in aborts.
+func TerminalApprover(in io.Reader, out io.Writer) Approver {
+	return &terminalApprover{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+type terminalApprover struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (t *terminalApprover) Approve(
+	ctx context.Context,
+	req ApprovalRequest,
+) (Decision, error) {
+	verb := "Apply"
+	if req.Destroy {
+		verb = "Destroy"
+	}
+	if len(req.Prune) > 0 {
+		verb = "Prune"
+	}
+	fmt.Fprintf(t.out, "\n%s action %q (%s)\n", verb, req.ActionName, req.ActionType)
+	if len(req.Prune) > 0 {
+		for _, sr := range req.Prune {
+			fmt.Fprintf(t.out, "  - %s\n", sr.Address)
+		}
+	} else {
+		fmt.Fprintf(t.out, "  Plan: %s\n", req.Plan)
+		for _, addr := range req.Changes {
+			fmt.Fprintf(t.out, "  ~ %s\n", addr)
+		}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return DecisionAbort, err
+		}
+		fmt.Fprint(t.out, "[y]es, [s]kip or [a]bort? ")
+		line, err := t.in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return DecisionAbort, fmt.Errorf("reading answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return DecisionApprove, nil
+		case "s", "skip":
+			return DecisionSkip, nil
+		case "a", "abort":
+			return DecisionAbort, nil
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(t.out)
+			return DecisionAbort, nil
+		}
+	}
+}
+
+// approve asks the approver, if any, to approve the request.
+// It returns true if the changes should be applied.
+func approve(
+	ctx context.Context,
+	approver Approver,
+	req ApprovalRequest,
+) (bool, error) {
+	if approver == nil {
+		return true, nil
+	}
+	decision, err := approver.Approve(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("approving %s: %w", req.ActionName, err)
+	}
+	switch decision {
+	case DecisionApprove:
+		return true, nil
+	case DecisionSkip:
+		return false, nil
+	case DecisionAbort:
+		return false, fmt.Errorf("%w: %s", ErrApplyAborted, req.ActionName)
+	default:
+		return false, fmt.Errorf("unknown decision: %s", decision)
+	}
+}
@@ -0,0 +1,189 @@
+package sylt_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"github.com/golingon/lingon/pkg/x/sylt/sylttest"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestTerminalApprover(t *testing.T) {
+	ctx := context.Background()
+	req := sylt.ApprovalRequest{
+		ActionName: "network",
+		ActionType: sylt.ActionTypeTerra,
+		Plan:       sylt.PlanSummary{Add: 1},
+		Changes:    []string{"aws_vpc.main"},
+	}
+	tests := []struct {
+		input string
+		exp   sylt.Decision
+	}{
+		{"y\n", sylt.DecisionApprove},
+		{"what?\nskip\n", sylt.DecisionSkip},
+		{"a\n", sylt.DecisionAbort},
+		{"", sylt.DecisionAbort},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		approver := sylt.TerminalApprover(strings.NewReader(tt.input), &out)
+		decision, err := approver.Approve(ctx, req)
+		tu.AssertNoError(t, err)
+		tu.AssertEqual(t, tt.exp, decision)
+		tu.AssertEqual(
+			t,
+			true,
+			strings.Contains(out.String(), "Plan: 1 to add, 0 to change, 0 to destroy"),
+		)
+	}
+}
+
+func TestWorkflowApprover(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	ctx := context.Background()
+	newAction := func(t *testing.T, name string) (*sylt.TerraAction[*stack], *sylttest.Fake) {
+		fake := sylttest.NewFake()
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, true, tfjson.Plan{
+			FormatVersion: "1.2",
+			ResourceChanges: []*tfjson.ResourceChange{
+				{
+					Address: "random_string.test",
+					Change: &tfjson.Change{
+						Actions: tfjson.Actions{tfjson.ActionCreate},
+					},
+				},
+			},
+		}))
+		tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+		return sylt.Terra(
+			name,
+			&stack{},
+			sylt.WithTerraCmder(fake),
+			sylt.WithTerraDir(t.TempDir()),
+			sylt.WithTerraOutput(io.Discard, io.Discard),
+		), fake
+	}
+	hasApply := func(fake *sylttest.Fake) bool {
+		for _, key := range fake.Keys() {
+			if key == sylttest.KeyApply {
+				return true
+			}
+		}
+		return false
+	}
+
+	var requests []sylt.ApprovalRequest
+	wf := sylt.NewWorkflow(
+		sylt.WithWorkflowDryRun(false),
+		sylt.WithWorkflowApprover(sylt.ApproverFunc(
+			func(ctx context.Context, req sylt.ApprovalRequest) (sylt.Decision, error) {
+				requests = append(requests, req)
+				switch req.ActionName {
+				case "skipped":
+					return sylt.DecisionSkip, nil
+				case "approved":
+					return sylt.DecisionApprove, nil
+				}
+				return sylt.DecisionAbort, nil
+			},
+		)),
+	)
+	skipped, skippedFake := newAction(t, "skipped")
+	approved, approvedFake := newAction(t, "approved")
+	aborted, abortedFake := newAction(t, "aborted")
+	tu.AssertNoError(t, wf.Run(ctx, skipped))
+	tu.AssertNoError(t, wf.Run(ctx, approved))
+	err := wf.Run(ctx, aborted)
+	tu.AssertEqual(t, true, errors.Is(err, sylt.ErrApplyAborted))
+
+	tu.AssertEqual(t, false, hasApply(skippedFake))
+	tu.AssertEqual(t, true, hasApply(approvedFake))
+	tu.AssertEqual(t, false, hasApply(abortedFake))
+	tu.AssertEqual(t, 3, len(requests))
+	tu.AssertEqual(t, sylt.PlanSummary{Add: 1}, requests[0].Plan)
+	tu.AssertEqualSlice(t, []string{"random_string.test"}, requests[0].Changes)
+}
+
+func TestCleanupSkippedDestroy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "journal.json")
+	newFake := func(t *testing.T) *sylttest.Fake {
+		fake := sylttest.NewFake()
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, false, tfjson.Plan{
+			FormatVersion: "1.2",
+		}))
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlanDestroy, true, tfjson.Plan{
+			FormatVersion: "1.2",
+		}))
+		tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+		return fake
+	}
+	hasApply := func(fake *sylttest.Fake) bool {
+		return slices.Contains(fake.Keys(), sylttest.KeyApply)
+	}
+	destroy := sylt.DecisionSkip
+	approver := sylt.ApproverFunc(func(
+		ctx context.Context,
+		req sylt.ApprovalRequest,
+	) (sylt.Decision, error) {
+		if req.Destroy {
+			return destroy, nil
+		}
+		return sylt.DecisionApprove, nil
+	})
+	newWorkflow := func() *sylt.Workflow {
+		return sylt.NewWorkflow(
+			sylt.WithWorkflowDryRun(false),
+			sylt.WithWorkflowJournal(path),
+			sylt.WithWorkflowApprover(approver),
+		)
+	}
+
+	fake := newFake(t)
+	wf := newWorkflow()
+	tu.AssertNoError(t, wf.Run(ctx, sylt.Terra(
+		"test",
+		&terra.Stack{},
+		sylt.WithTerraCmder(fake),
+		sylt.WithTerraDir(dir),
+		sylt.WithTerraOutput(io.Discard, io.Discard),
+	)))
+	tu.AssertNoError(t, wf.Cleanup(ctx, sylt.WithCleanupDestroy(true)))
+	tu.False(t, hasApply(fake), "skipped destroy should not apply")
+
+	// The skipped action is still live, so the journal must not record it
+	// as destroyed.
+	journal, err := sylt.LoadJournal(path)
+	tu.AssertNoError(t, err)
+	tu.AssertEqual(t, sylt.ActionOutcomeSucceeded, journal.Entries[0].Outcome)
+
+	// A later cleanup from the journal destroys it.
+	destroy = sylt.DecisionApprove
+	fake = newFake(t)
+	tu.AssertNoError(t, newWorkflow().CleanupJournal(
+		ctx,
+		sylt.TerraResolver(
+			sylt.WithTerraCmder(fake),
+			sylt.WithTerraDir(dir),
+			sylt.WithTerraOutput(io.Discard, io.Discard),
+		),
+		sylt.WithCleanupDestroy(true),
+	))
+	tu.True(t, hasApply(fake), "cleanup from the journal should destroy")
+	journal, err = sylt.LoadJournal(path)
+	tu.AssertNoError(t, err)
+	tu.AssertEqual(t, sylt.ActionOutcomeDestroyed, journal.Entries[0].Outcome)
+}
@@ -0,0 +1,130 @@
+package sylt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+const ActionTypeCmd ActionType = "cmd"
+
+type CmdOption func(*cmdOpts)
+
+// WithCmdDir sets the working directory of the commands.
+func WithCmdDir(dir string) CmdOption {
+	return func(o *cmdOpts) {
+		o.dir = dir
+	}
+}
+
+// WithCmdEnv adds environment variables, in the form "KEY=value", to the
+// commands.
+func WithCmdEnv(env ...string) CmdOption {
+	return func(o *cmdOpts) {
+		o.env = append(o.env, env...)
+	}
+}
+
+// WithCmdOutput sets where the output of the commands is written.
+// It defaults to [os.Stdout] and [os.Stderr], with each line prefixed by the
+// action name in brackets.
+func WithCmdOutput(stdout, stderr io.Writer) CmdOption {
+	return func(o *cmdOpts) {
+		o.stdout = stdout
+		o.stderr = stderr
+	}
+}
+
+// WithCmdCleanup sets the command which cleans up after the action, e.g.
+// `helm uninstall`.
+func WithCmdCleanup(args ...string) CmdOption {
+	return func(o *cmdOpts) {
+		o.cleanup = args
+	}
+}
+
+// WithCmdDryRun sets the command which is run in dry-run and drift mode
+// instead of the action's command, e.g. `helm upgrade --dry-run`.
+// By default nothing is run in dry-run mode.
+func WithCmdDryRun(args ...string) CmdOption {
+	return func(o *cmdOpts) {
+		o.dryRun = args
+	}
+}
+
+// WithCmdShouldRun sets a predicate which decides whether the command runs,
+// see [WithFuncShouldRun].
+func WithCmdShouldRun(fn ShouldRunFunc) CmdOption {
+	return func(o *cmdOpts) {
+		o.shouldRun = fn
+	}
+}
+
+type cmdOpts struct {
+	dir       string
+	env       []string
+	stdout    io.Writer
+	stderr    io.Writer
+	cleanup   []string
+	dryRun    []string
+	shouldRun ShouldRunFunc
+}
+
+// Cmd creates a new action which runs a command, e.g. a database migration
+// tool or helm.
+// The first argument is the command and the rest are its arguments.
+func Cmd(name string, args []string, opts ...CmdOption) *FuncAction {
+	opt := cmdOpts{
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	prefix := "[" + name + "] "
+	stdout := newPrefixWriter(opt.stdout, prefix)
+	stderr := newPrefixWriter(opt.stderr, prefix)
+	run := func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("command of %s is empty", name)
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Dir = opt.dir
+		cmd.Env = append(os.Environ(), opt.env...)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running command %s: %w", args[0], err)
+		}
+		return nil
+	}
+
+	funcOpts := []FuncOption{
+		WithFuncShouldRun(opt.shouldRun),
+		WithFuncDryRun(opt.dryRun != nil),
+	}
+	if opt.cleanup != nil {
+		funcOpts = append(
+			funcOpts,
+			WithFuncCleanup(func(ctx context.Context, o RunOpts) error {
+				if o.DryRun {
+					return nil
+				}
+				return run(ctx, opt.cleanup)
+			}),
+		)
+	}
+	return newFuncAction(
+		name,
+		ActionTypeCmd,
+		func(ctx context.Context, o RunOpts) error {
+			if o.DryRun || o.Drift {
+				return run(ctx, opt.dryRun)
+			}
+			return run(ctx, args)
+		},
+		funcOpts...,
+	)
+}
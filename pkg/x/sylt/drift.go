@@ -0,0 +1,175 @@
+package sylt
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DriftDetector is implemented by actions that support drift detection.
+// When a workflow runs with [WithWorkflowDrift], the actions are run with
+// [RunOpts.Drift] set and the results are collected into a [DriftReport].
+type DriftDetector interface {
+	// DriftResult returns the result of the drift detection.
+	// It returns false if drift detection has not been run for the action.
+	DriftResult() (DriftResult, bool)
+}
+
+// DriftStatus classifies the result of drift detection for an action.
+type DriftStatus string
+
+const (
+	// DriftStatusInSync means the infrastructure matches the action.
+	DriftStatusInSync DriftStatus = "in-sync"
+	// DriftStatusDrifted means the infrastructure was changed outside of the
+	// action, or the action has changes that have not been applied.
+	DriftStatusDrifted DriftStatus = "drifted"
+	// DriftStatusStateOverflow means the state has resources that are not
+	// part of the action (see [StateStatusOverflow]).
+	DriftStatusStateOverflow DriftStatus = "state-overflow"
+)
+
+// DriftResult is the result of drift detection for a single action.
+type DriftResult struct {
+	ActionName  string      `json:"action_name"`
+	ActionType  ActionType  `json:"action_type"`
+	Status      DriftStatus `json:"status"`
+	StateStatus StateStatus `json:"state_status"`
+	// Drifted contains the addresses of resources that were changed outside
+	// of terra (i.e. found by a refresh-only plan).
+	Drifted []string `json:"drifted,omitempty"`
+	// Pending contains the addresses of resources with changes in the stack
+	// that have not been applied.
+	Pending []string `json:"pending,omitempty"`
+	// Overflow contains the resources in the state which are not in the stack.
+	Overflow []StateResource `json:"overflow,omitempty"`
+}
+
+// driftStatus classifies the outcome of the refresh-only and normal plans,
+// together with the status of the state.
+func driftStatus(
+	stateStatus StateStatus,
+	drifted []string,
+	pending []string,
+) DriftStatus {
+	switch {
+	case stateStatus == StateStatusOverflow:
+		return DriftStatusStateOverflow
+	case len(drifted) > 0, len(pending) > 0:
+		return DriftStatusDrifted
+	case stateStatus == StateStatusPartial:
+		return DriftStatusDrifted
+	default:
+		return DriftStatusInSync
+	}
+}
+
+// DriftReport is the consolidated result of drift detection for a workflow.
+// Use [Workflow.DriftReport] to create it.
+type DriftReport struct {
+	Results []DriftResult `json:"results"`
+}
+
+// HasDrift returns true if any of the actions are not in sync.
+func (r *DriftReport) HasDrift() bool {
+	for _, res := range r.Results {
+		if res.Status != DriftStatusInSync {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the drift report as indented JSON to w.
+func (r *DriftReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("encoding drift report: %w", err)
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the drift report as JUnit XML to w, so that it can be
+// consumed by CI dashboards.
+// Each action is a test case, which fails if the action is not in sync.
+func (r *DriftReport) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      "sylt-drift",
+		Tests:     len(r.Results),
+		TestCases: make([]junitTestCase, len(r.Results)),
+	}
+	for i, res := range r.Results {
+		tc := junitTestCase{
+			Name:      res.ActionName,
+			ClassName: "sylt." + string(res.ActionType),
+		}
+		if res.Status != DriftStatusInSync {
+			suite.Failures++
+			var text strings.Builder
+			fmt.Fprintf(&text, "state status: %s\n", res.StateStatus)
+			for _, addr := range res.Drifted {
+				fmt.Fprintf(&text, "drifted: %s\n", addr)
+			}
+			for _, addr := range res.Pending {
+				fmt.Fprintf(&text, "pending: %s\n", addr)
+			}
+			for _, sr := range res.Overflow {
+				fmt.Fprintf(&text, "overflow: %s\n", sr.Address)
+			}
+			tc.Failure = &junitFailure{
+				Message: string(res.Status),
+				Type:    string(res.Status),
+				Text:    text.String(),
+			}
+		}
+		suite.TestCases[i] = tc
+	}
+	suites := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("writing xml header: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return fmt.Errorf("encoding junit report: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("writing junit report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package sylt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+var _ TerraCmder = (*driftRecorder)(nil)
+
+// driftRecorder returns plans with the given drifted and pending resources.
+type driftRecorder struct {
+	drifted    []string
+	pending    []string
+	stateExtra bool
+
+	calls    [][]string
+	lastPlan []string
+}
+
+func (d *driftRecorder) Run(
+	ctx context.Context,
+	cmd TerraCmd,
+) error {
+	args := cmd.Args
+	stdout := cmd.Stdout
+	d.calls = append(d.calls, args)
+	switch {
+	case slices.Equal(args, terraCallShowPlan):
+		plan := tfjson.Plan{
+			FormatVersion: "1.0",
+		}
+		changes := d.pending
+		if slices.Equal(d.lastPlan, terraCallPlanRefreshOnly) {
+			changes = nil
+			plan.ResourceDrift = resourceChanges(d.drifted)
+		}
+		plan.ResourceChanges = resourceChanges(changes)
+		return json.NewEncoder(stdout).Encode(plan)
+	case slices.Equal(args, terraCallShowState):
+		state := tfjson.State{
+			FormatVersion: "1.0",
+			Values: &tfjson.StateValues{
+				RootModule: &tfjson.StateModule{},
+			},
+		}
+		if d.stateExtra {
+			state.Values.RootModule.Resources = []*tfjson.StateResource{
+				{Address: "dummy.extra", Type: "dummy", Name: "extra"},
+			}
+		}
+		return json.NewEncoder(stdout).Encode(state)
+	case len(args) > 0 && args[0] == "plan":
+		d.lastPlan = args
+	}
+	return nil
+}
+
+func resourceChanges(addrs []string) []*tfjson.ResourceChange {
+	changes := make([]*tfjson.ResourceChange, len(addrs))
+	for i, addr := range addrs {
+		changes[i] = &tfjson.ResourceChange{
+			Address: addr,
+			Change: &tfjson.Change{
+				Actions: tfjson.Actions{tfjson.ActionUpdate},
+			},
+		}
+	}
+	return changes
+}
+
+func TestTerraDrift(t *testing.T) {
+	type test struct {
+		name      string
+		rec       *driftRecorder
+		expResult DriftResult
+	}
+	tests := []test{
+		{
+			name: "in sync",
+			rec:  &driftRecorder{},
+			expResult: DriftResult{
+				Status:      DriftStatusInSync,
+				StateStatus: StateStatusEmpty,
+			},
+		},
+		{
+			name: "drifted",
+			rec: &driftRecorder{
+				drifted: []string{"dummy.a"},
+				pending: []string{"dummy.b"},
+			},
+			expResult: DriftResult{
+				Status:      DriftStatusDrifted,
+				StateStatus: StateStatusEmpty,
+				Drifted:     []string{"dummy.a"},
+				Pending:     []string{"dummy.b"},
+			},
+		},
+		{
+			name: "state overflow",
+			rec:  &driftRecorder{stateExtra: true},
+			expResult: DriftResult{
+				Status:      DriftStatusStateOverflow,
+				StateStatus: StateStatusOverflow,
+				Overflow: []StateResource{
+					{Address: "dummy.extra", Type: "dummy", Name: "extra"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type stack struct {
+				terra.Stack
+			}
+			ctx := context.Background()
+			terraAct := Terra("test", &stack{}, WithTerraCmder(tt.rec))
+
+			wf := NewWorkflow(
+				WithWorkflowDryRun(false),
+				WithWorkflowDestroy(true),
+				WithWorkflowDrift(true),
+			)
+			tu.AssertNoError(t, wf.Run(ctx, terraAct))
+			tu.AssertNoError(t, wf.Cleanup(ctx))
+
+			// Nothing should ever be applied in drift mode, and cleanup should
+			// not destroy anything.
+			for _, args := range tt.rec.calls {
+				tu.IsNotEqual(t, "apply", args[0])
+				tu.IsEqual(t, false, slices.Equal(args, terraCallPlanDestroy))
+			}
+
+			tt.expResult.ActionName = "test"
+			tt.expResult.ActionType = ActionTypeTerra
+			report := wf.DriftReport()
+			if diff := tu.Diff(report.Results, []DriftResult{tt.expResult}); diff != "" {
+				t.Fatal(diff)
+			}
+			tu.AssertEqual(
+				t,
+				tt.expResult.Status != DriftStatusInSync,
+				report.HasDrift(),
+			)
+		})
+	}
+}
+
+func TestDriftReportJUnit(t *testing.T) {
+	report := DriftReport{
+		Results: []DriftResult{
+			{
+				ActionName:  "network",
+				ActionType:  ActionTypeTerra,
+				Status:      DriftStatusInSync,
+				StateStatus: StateStatusSync,
+			},
+			{
+				ActionName:  "cluster",
+				ActionType:  ActionTypeTerra,
+				Status:      DriftStatusDrifted,
+				StateStatus: StateStatusSync,
+				Drifted:     []string{"aws_eks_cluster.main"},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	tu.AssertNoError(t, report.WriteJUnit(&buf))
+	exp := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="sylt-drift" tests="2" failures="1">
+  <testsuite name="sylt-drift" tests="2" failures="1">
+    <testcase name="network" classname="sylt.terra"></testcase>
+    <testcase name="cluster" classname="sylt.terra">
+      <failure message="drifted" type="drifted">state status: sync&#xA;drifted: aws_eks_cluster.main&#xA;</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if diff := tu.Diff(buf.String(), exp); diff != "" {
+		t.Fatal(diff)
+	}
+
+	buf.Reset()
+	tu.AssertNoError(t, report.WriteJSON(&buf))
+	tu.AssertEqual(
+		t,
+		true,
+		strings.Contains(buf.String(), `"state_status": "sync"`),
+	)
+}
+
+// optsRecorder records the options it is run with.
+type optsRecorder struct {
+	opts []RunOpts
+}
+
+func (r *optsRecorder) ActionName() string                     { return "recorder" }
+func (r *optsRecorder) ActionType() ActionType                 { return "recorder" }
+func (r *optsRecorder) Cleanup(context.Context, RunOpts) error { return nil }
+
+func (r *optsRecorder) Run(_ context.Context, opts RunOpts) error {
+	r.opts = append(r.opts, opts)
+	return nil
+}
+
+func TestDriftForcesDryRun(t *testing.T) {
+	ctx := context.Background()
+	rec := &optsRecorder{}
+	var called bool
+	fn := Func("fn", func(context.Context, RunOpts) error {
+		called = true
+		return nil
+	})
+
+	wf := NewWorkflow(WithWorkflowDryRun(false), WithWorkflowDrift(true))
+	tu.AssertNoError(t, wf.Run(ctx, rec))
+	tu.AssertNoError(t, wf.Run(ctx, fn))
+
+	tu.AssertEqual(t, 1, len(rec.opts))
+	tu.True(t, rec.opts[0].Drift, "drift should be set")
+	tu.True(t, rec.opts[0].DryRun, "dry run should be set in drift mode")
+	tu.False(t, called, "function should not be called in drift mode")
+}
@@ -0,0 +1,149 @@
+package sylt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/golingon/lingon/pkg/terra"
+)
+
+var ErrEnvironmentMismatch = errors.New(
+	"action environment does not match workflow",
+)
+
+// Environment is an environment, e.g. dev, staging or prod, to which the same
+// stacks are deployed with different parameters.
+//
+// Use [WithTerraEnvironment] to deploy a [TerraAction] to an environment, and
+// [WithWorkflowEnvironment] to make sure a workflow only runs actions for a
+// single environment.
+type Environment struct {
+	// Name is the name of the environment, e.g. "prod".
+	Name string
+	// Params are the parameters of the environment, e.g. the region or the
+	// size of a cluster.
+	Params map[string]string
+	// Backend creates the backend for an action in the environment, given its
+	// state key (see [StateKey]), which is prefixed with the environment name.
+	// If nil, the backend of the stack is used.
+	Backend func(key string) terra.Backend
+}
+
+// Param returns the parameter with the given key, or an error if the
+// environment does not have it.
+func (e Environment) Param(key string) (string, error) {
+	v, ok := e.Params[key]
+	if !ok {
+		return "", fmt.Errorf(
+			"environment %s: missing parameter %s", e.Name, key,
+		)
+	}
+	return v, nil
+}
+
+// EnvironmentActioner is implemented by actions which belong to an
+// environment, e.g. [TerraAction].
+type EnvironmentActioner interface {
+	ActionEnvironment() string
+}
+
+// SelectEnvironments returns the environments with the given names, in the
+// order of the names, e.g. from a command line flag.
+// If no names are given, all environments are returned.
+func SelectEnvironments(
+	envs []Environment,
+	names ...string,
+) ([]Environment, error) {
+	if len(names) == 0 {
+		return envs, nil
+	}
+	selected := make([]Environment, 0, len(names))
+	for _, name := range names {
+		i := -1
+		for j, env := range envs {
+			if env.Name == name {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("unknown environment: %s", name)
+		}
+		selected = append(selected, envs[i])
+	}
+	return selected, nil
+}
+
+// RunEnvironments runs a workflow for each environment, in order, e.g. to
+// deploy dev before prod.
+// The actions function creates the actions for an environment, which are run
+// with [Workflow.RunAll] and then cleaned up with [Workflow.Cleanup].
+// Each workflow is restricted to its environment, see
+// [WithWorkflowEnvironment].
+// If a journal is enabled, each environment gets its own journal in a
+// sub directory named after the environment.
+// It stops at the first environment which fails.
+func RunEnvironments(
+	ctx context.Context,
+	envs []Environment,
+	actions func(env Environment) ([]Actioner, error),
+	opts ...WorkflowOption,
+) error {
+	for _, env := range envs {
+		wf := NewWorkflow(append(
+			slices.Clone(opts),
+			WithWorkflowEnvironment(env.Name),
+		)...)
+		if wf.opts.JournalPath != "" {
+			wf.opts.JournalPath = filepath.Join(
+				filepath.Dir(wf.opts.JournalPath),
+				env.Name,
+				filepath.Base(wf.opts.JournalPath),
+			)
+		}
+		acts, err := actions(env)
+		if err != nil {
+			return fmt.Errorf(
+				"environment %s: creating actions: %w", env.Name, err,
+			)
+		}
+		if err := wf.RunAll(ctx, acts...); err != nil {
+			return fmt.Errorf("environment %s: %w", env.Name, err)
+		}
+		if err := wf.Cleanup(ctx); err != nil {
+			return fmt.Errorf("environment %s: %w", env.Name, err)
+		}
+	}
+	return nil
+}
+
+// envStateKey returns the state key of an action in the environment.
+func envStateKey(env, name string) string {
+	if env == "" {
+		return StateKey(name)
+	}
+	return path.Join(StateKey(env), StateKey(name))
+}
+
+// checkEnv makes sure that the action belongs to the environment of the
+// workflow, if any.
+func (w *Workflow) checkEnv(action Actioner) error {
+	if w.opts.Environment == "" {
+		return nil
+	}
+	envAction, ok := AsAction[EnvironmentActioner](action)
+	if !ok || envAction.ActionEnvironment() == "" {
+		return nil
+	}
+	if env := envAction.ActionEnvironment(); env != w.opts.Environment {
+		return fmt.Errorf(
+			"running action %s: %w: action is for %s, workflow is for %s",
+			action.ActionName(), ErrEnvironmentMismatch, env, w.opts.Environment,
+		)
+	}
+	return nil
+}
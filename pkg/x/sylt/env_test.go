@@ -0,0 +1,184 @@
+package sylt_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"github.com/golingon/lingon/pkg/x/sylt/sylttest"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestEnvironment(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	ctx := context.Background()
+	envs := []sylt.Environment{
+		{
+			Name:   "dev",
+			Params: map[string]string{"region": "eu-north-1"},
+			Backend: func(key string) terra.Backend {
+				return &terra.BackendLocal{Path: key + ".tfstate"}
+			},
+		},
+		{
+			Name:   "prod",
+			Params: map[string]string{"region": "eu-west-1"},
+			Backend: func(key string) terra.Backend {
+				return &terra.BackendLocal{Path: key + ".tfstate"}
+			},
+		},
+	}
+	newAction := func(
+		t *testing.T,
+		fake *sylttest.Fake,
+		env sylt.Environment,
+	) *sylt.TerraAction[*stack] {
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, false, tfjson.Plan{
+			FormatVersion: "1.2",
+		}))
+		tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+		return sylt.Terra(
+			"network",
+			&stack{},
+			sylt.WithTerraCmder(fake),
+			sylt.WithTerraOutput(io.Discard, io.Discard),
+			sylt.WithTerraEnvironment(env),
+		)
+	}
+
+	t.Run("param", func(t *testing.T) {
+		region, err := envs[0].Param("region")
+		tu.AssertNoError(t, err)
+		tu.AssertEqual(t, "eu-north-1", region)
+		_, err = envs[0].Param("zone")
+		tu.AssertErrorMsg(t, err, "environment dev: missing parameter zone")
+	})
+
+	t.Run("select", func(t *testing.T) {
+		selected, err := sylt.SelectEnvironments(envs, "prod")
+		tu.AssertNoError(t, err)
+		tu.AssertEqual(t, 1, len(selected))
+		tu.AssertEqual(t, "prod", selected[0].Name)
+		_, err = sylt.SelectEnvironments(envs, "test")
+		tu.AssertErrorMsg(t, err, "unknown environment: test")
+	})
+
+	t.Run("run", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		fake := sylttest.NewFake()
+		journal := filepath.Join(".lingon", "journal.json")
+		err := sylt.RunEnvironments(
+			ctx,
+			envs,
+			func(env sylt.Environment) ([]sylt.Actioner, error) {
+				return []sylt.Actioner{newAction(t, fake, env)}, nil
+			},
+			sylt.WithWorkflowJournal(journal),
+		)
+		tu.AssertNoError(t, err)
+		dirs := map[string]bool{}
+		for _, call := range fake.Calls() {
+			dirs[call.Dir] = true
+		}
+		tu.AssertEqual(t, 2, len(dirs))
+		for _, env := range []string{"dev", "prod"} {
+			dir := filepath.Join(".lingon", "terra", env, "network")
+			tu.True(t, dirs[dir], "missing calls in "+dir)
+			b, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+			tu.AssertNoError(t, err)
+			tu.AssertEqual(t, `terraform {
+  backend "local" {
+    path = "`+env+`/network.tfstate"
+  }
+}
+
+`, string(b))
+			_, err = os.Stat(filepath.Join(".lingon", env, "journal.json"))
+			tu.AssertNoError(t, err)
+		}
+
+		// Cleanup from the journal destroys the action in its environment.
+		devJournal := filepath.Join(".lingon", "dev", "journal.json")
+		j, err := sylt.LoadJournal(devJournal)
+		tu.AssertNoError(t, err)
+		tu.AssertEqual(t, "dev", j.Entries[0].Environment)
+		var report strings.Builder
+		tu.AssertNoError(t, j.Report(&report))
+		lines := strings.Split(report.String(), "\n")
+		tu.AssertEqualSlice(
+			t,
+			[]string{"NAME", "TYPE", "ENVIRONMENT"},
+			strings.Fields(lines[1])[:3],
+		)
+		tu.AssertEqualSlice(
+			t,
+			[]string{"network", "terra", "dev"},
+			strings.Fields(lines[2])[:3],
+		)
+		wf := sylt.NewWorkflow(
+			sylt.WithWorkflowEnvironment("dev"),
+			sylt.WithWorkflowJournal(devJournal),
+		)
+		err = wf.CleanupJournal(
+			ctx,
+			sylt.TerraResolver(sylt.WithTerraCmder(fake)),
+			sylt.WithCleanupDestroy(true),
+		)
+		tu.AssertErrorMsg(
+			t,
+			err,
+			"resolving action network: unknown environment: dev",
+		)
+		cleanupFake := sylttest.NewFake()
+		tu.AssertNoError(t, cleanupFake.Plan(
+			sylttest.KeyPlanDestroy,
+			false,
+			tfjson.Plan{FormatVersion: "1.2"},
+		))
+		tu.AssertNoError(t, wf.CleanupJournal(
+			ctx,
+			sylt.TerraEnvResolver(
+				envs,
+				sylt.WithTerraCmder(cleanupFake),
+				sylt.WithTerraOutput(io.Discard, io.Discard),
+			),
+			sylt.WithCleanupDryRun(false),
+			sylt.WithCleanupDestroy(true),
+		))
+		calls := cleanupFake.Calls()
+		tu.True(t, len(calls) > 0, "cleanup should run terra commands")
+		for _, call := range calls {
+			tu.AssertEqual(
+				t,
+				filepath.Join(".lingon", "terra", "dev", "network"),
+				call.Dir,
+			)
+		}
+		j, err = sylt.LoadJournal(devJournal)
+		tu.AssertNoError(t, err)
+		tu.AssertEqual(t, sylt.ActionOutcomeDestroyed, j.Entries[0].Outcome)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		wf := sylt.NewWorkflow(sylt.WithWorkflowEnvironment("dev"))
+		err := wf.Run(ctx, newAction(t, sylttest.NewFake(), envs[1]))
+		if !errors.Is(err, sylt.ErrEnvironmentMismatch) {
+			t.Fatalf("expected environment mismatch, got: %v", err)
+		}
+		tu.AssertErrorMsg(
+			t,
+			err,
+			"running action network: action environment does not match workflow: action is for prod, workflow is for dev",
+		)
+	})
+}
@@ -0,0 +1,144 @@
+package sylt
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+const ActionTypeFunc ActionType = "func"
+
+// ActionFunc is the function run by a [FuncAction].
+type ActionFunc func(ctx context.Context, opts RunOpts) error
+
+// ShouldRunFunc reports whether an action needs to run, e.g. by checking
+// whether database migrations are up to date.
+// It makes actions which are not naturally idempotent safe to run repeatedly.
+type ShouldRunFunc func(ctx context.Context) (bool, error)
+
+type FuncOption func(*funcOpts)
+
+// WithFuncCleanup sets the function which cleans up after the action, e.g.
+// to undo what it did.
+// It is only called if destroy is true.
+func WithFuncCleanup(fn ActionFunc) FuncOption {
+	return func(o *funcOpts) {
+		o.cleanup = fn
+	}
+}
+
+// WithFuncShouldRun sets a predicate which decides whether the action runs.
+// If it returns false, the action is skipped.
+// The predicate is also checked in dry-run mode, so it must not make any
+// changes.
+func WithFuncShouldRun(fn ShouldRunFunc) FuncOption {
+	return func(o *funcOpts) {
+		o.shouldRun = fn
+	}
+}
+
+// WithFuncDryRun sets whether the function is called in dry-run and drift
+// mode.
+// By default it is not, as the function may make changes.
+// Enable it for functions which honour [RunOpts.DryRun] or do not make any
+// changes, e.g. smoke tests.
+func WithFuncDryRun(b bool) FuncOption {
+	return func(o *funcOpts) {
+		o.dryRun = b
+	}
+}
+
+type funcOpts struct {
+	cleanup   ActionFunc
+	shouldRun ShouldRunFunc
+	dryRun    bool
+}
+
+var _ Actioner = (*FuncAction)(nil)
+
+// FuncAction is an action that runs a Go function, for things that are
+// neither terra nor kube, e.g. database migrations or smoke tests.
+// Use the [Func] function to create a FuncAction, or [Cmd] to run a command.
+type FuncAction struct {
+	// Name is the name of the action.
+	Name string
+	// Type is the type of the action, e.g. [ActionTypeFunc].
+	Type ActionType
+
+	opts funcOpts
+	run  ActionFunc
+	log  *slog.Logger
+}
+
+// Func creates a new FuncAction which runs fn.
+func Func(name string, fn ActionFunc, opts ...FuncOption) *FuncAction {
+	return newFuncAction(name, ActionTypeFunc, fn, opts...)
+}
+
+func newFuncAction(
+	name string,
+	typ ActionType,
+	fn ActionFunc,
+	opts ...FuncOption,
+) *FuncAction {
+	var opt funcOpts
+	for _, o := range opts {
+		o(&opt)
+	}
+	return &FuncAction{
+		Name: name,
+		Type: typ,
+		opts: opt,
+		run:  fn,
+		log: slog.With(
+			"action_name",
+			name,
+			"action_type",
+			typ,
+		),
+	}
+}
+
+func (a *FuncAction) ActionName() string {
+	return a.Name
+}
+
+func (a *FuncAction) ActionType() ActionType {
+	return a.Type
+}
+
+func (a *FuncAction) Run(ctx context.Context, opts RunOpts) error {
+	runLog := a.log.With("run_opts", opts)
+	// Destroying happens in Cleanup.
+	if opts.Destroy {
+		return nil
+	}
+	if (opts.DryRun || opts.Drift) && !a.opts.dryRun {
+		runLog.Info("dry run, skipping")
+		return nil
+	}
+	if a.opts.shouldRun != nil {
+		ok, err := a.opts.shouldRun(ctx)
+		if err != nil {
+			return fmt.Errorf("checking if %s should run: %w", a.Name, err)
+		}
+		if !ok {
+			runLog.Info("up to date, skipping")
+			return nil
+		}
+	}
+	runLog.Info("running")
+	return a.run(ctx, opts)
+}
+
+func (a *FuncAction) Cleanup(ctx context.Context, opts RunOpts) error {
+	if a.opts.cleanup == nil {
+		return nil
+	}
+	if opts.DryRun && !a.opts.dryRun {
+		a.log.Info("dry run, skipping cleanup")
+		return nil
+	}
+	a.log.Info("cleaning up")
+	return a.opts.cleanup(ctx, opts)
+}
@@ -0,0 +1,141 @@
+package sylt_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+)
+
+func TestFuncAction(t *testing.T) {
+	type test struct {
+		name      string
+		wfOpts    []sylt.WorkflowOption
+		funcOpts  []sylt.FuncOption
+		shouldRun bool
+		expCalls  []string
+	}
+	tests := []test{
+		{
+			name:      "run",
+			wfOpts:    []sylt.WorkflowOption{sylt.WithWorkflowDryRun(false)},
+			shouldRun: true,
+			expCalls:  []string{"should run", "run"},
+		},
+		{
+			name:      "up to date",
+			wfOpts:    []sylt.WorkflowOption{sylt.WithWorkflowDryRun(false)},
+			shouldRun: false,
+			expCalls:  []string{"should run"},
+		},
+		{
+			name:      "dry run",
+			wfOpts:    []sylt.WorkflowOption{sylt.WithWorkflowDryRun(true)},
+			shouldRun: true,
+			expCalls:  nil,
+		},
+		{
+			name:      "dry run enabled",
+			wfOpts:    []sylt.WorkflowOption{sylt.WithWorkflowDryRun(true)},
+			funcOpts:  []sylt.FuncOption{sylt.WithFuncDryRun(true)},
+			shouldRun: true,
+			expCalls:  []string{"should run", "run dry"},
+		},
+		{
+			name: "destroy",
+			wfOpts: []sylt.WorkflowOption{
+				sylt.WithWorkflowDryRun(false),
+				sylt.WithWorkflowDestroy(true),
+			},
+			shouldRun: true,
+			expCalls:  []string{"cleanup"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var calls []string
+			opts := append([]sylt.FuncOption{
+				sylt.WithFuncShouldRun(func(ctx context.Context) (bool, error) {
+					calls = append(calls, "should run")
+					return tt.shouldRun, nil
+				}),
+				sylt.WithFuncCleanup(func(ctx context.Context, opts sylt.RunOpts) error {
+					calls = append(calls, "cleanup")
+					return nil
+				}),
+			}, tt.funcOpts...)
+			action := sylt.Func(
+				"migrate",
+				func(ctx context.Context, opts sylt.RunOpts) error {
+					if opts.DryRun {
+						calls = append(calls, "run dry")
+						return nil
+					}
+					calls = append(calls, "run")
+					return nil
+				},
+				opts...,
+			)
+			wf := sylt.NewWorkflow(tt.wfOpts...)
+			tu.AssertNoError(t, wf.Run(ctx, action))
+			tu.AssertNoError(t, wf.Cleanup(ctx))
+			tu.AssertEqualSlice(t, tt.expCalls, calls)
+		})
+	}
+
+	t.Run("should run error", func(t *testing.T) {
+		action := sylt.Func(
+			"migrate",
+			func(ctx context.Context, opts sylt.RunOpts) error { return nil },
+			sylt.WithFuncShouldRun(func(ctx context.Context) (bool, error) {
+				return false, errors.New("connection refused")
+			}),
+		)
+		err := action.Run(context.Background(), sylt.RunOpts{})
+		tu.AssertErrorMsg(
+			t,
+			err,
+			"checking if migrate should run: connection refused",
+		)
+	})
+}
+
+func TestCmdAction(t *testing.T) {
+	ctx := context.Background()
+	var stdout bytes.Buffer
+	newAction := func(opts ...sylt.CmdOption) *sylt.FuncAction {
+		return sylt.Cmd(
+			"helm",
+			[]string{"sh", "-c", `echo "install $RELEASE"`},
+			append([]sylt.CmdOption{
+				sylt.WithCmdEnv("RELEASE=app"),
+				sylt.WithCmdOutput(&stdout, &stdout),
+				sylt.WithCmdCleanup("sh", "-c", `echo "uninstall $RELEASE"`),
+			}, opts...)...,
+		)
+	}
+
+	tu.AssertNoError(t, newAction().Run(ctx, sylt.RunOpts{}))
+	tu.AssertNoError(t, newAction().Cleanup(ctx, sylt.RunOpts{Destroy: true}))
+	// Without a dry-run command, nothing runs in dry-run mode.
+	tu.AssertNoError(t, newAction().Run(ctx, sylt.RunOpts{DryRun: true}))
+	tu.AssertNoError(t, newAction(
+		sylt.WithCmdDryRun("sh", "-c", `echo "install $RELEASE --dry-run"`),
+	).Run(ctx, sylt.RunOpts{DryRun: true}))
+	tu.AssertEqual(
+		t,
+		"[helm] install app\n[helm] uninstall app\n[helm] install app --dry-run\n",
+		stdout.String(),
+	)
+
+	err := sylt.Cmd(
+		"fail",
+		[]string{"sh", "-c", "exit 3"},
+		sylt.WithCmdOutput(&stdout, &stdout),
+	).Run(ctx, sylt.RunOpts{})
+	tu.AssertErrorMsg(t, err, "running command sh: exit status 3")
+}
@@ -0,0 +1,304 @@
+package sylt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golingon/lingon/pkg/terra"
+	"github.com/google/uuid"
+)
+
+// DefaultJournalPath is the default location of the workflow run journal.
+var DefaultJournalPath = filepath.Join(".lingon", "journal.json")
+
+// ActionOutcome is the outcome of an action recorded in a [Journal].
+type ActionOutcome string
+
+const (
+	// ActionOutcomeRunning means the action was started but has not finished.
+	// If a journal is loaded with running actions, the process running the
+	// workflow most likely died.
+	ActionOutcomeRunning ActionOutcome = "running"
+	// ActionOutcomeSucceeded means the action finished without error.
+	ActionOutcomeSucceeded ActionOutcome = "succeeded"
+	// ActionOutcomeFailed means the action returned an error.
+	ActionOutcomeFailed ActionOutcome = "failed"
+	// ActionOutcomeResumed means the action was skipped when resuming a
+	// workflow because it had already succeeded.
+	ActionOutcomeResumed ActionOutcome = "resumed"
+	// ActionOutcomeDestroyed means the action has been cleaned up.
+	ActionOutcomeDestroyed ActionOutcome = "destroyed"
+)
+
+// PlanSummarizer is implemented by actions that can summarise the changes they
+// planned, e.g. [TerraAction].
+// The summary is recorded in the [Journal].
+type PlanSummarizer interface {
+	// PlanSummary returns the summary of the last plan.
+	// It returns false if there is no plan.
+	PlanSummary() (PlanSummary, bool)
+}
+
+// PlanSummary summarises the changes of a plan.
+type PlanSummary struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+}
+
+func (p PlanSummary) String() string {
+	return fmt.Sprintf(
+		"%d to add, %d to change, %d to destroy",
+		p.Add, p.Change, p.Destroy,
+	)
+}
+
+// JournalEntry records the run of a single action.
+type JournalEntry struct {
+	Name string     `json:"name"`
+	Type ActionType `json:"type"`
+	// Environment is the environment of the action, if any (see
+	// [EnvironmentActioner]).
+	Environment string        `json:"environment,omitempty"`
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end,omitzero"`
+	Plan        *PlanSummary  `json:"plan,omitempty"`
+	Outcome     ActionOutcome `json:"outcome"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Journal records the actions run by a [Workflow], so that a later invocation
+// can resume a failed workflow, report what happened, or destroy what a
+// previous process created.
+//
+// The journal is written to disk after every change, so that it survives the
+// process dying mid-way.
+// Use [WithWorkflowJournal] to enable the journal for a workflow and
+// [LoadJournal] to read it.
+type Journal struct {
+	RunID   string         `json:"run_id"`
+	Started time.Time      `json:"started"`
+	Entries []JournalEntry `json:"entries"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func newJournal(path string) *Journal {
+	return &Journal{
+		RunID:   uuid.Must(uuid.NewV7()).String(),
+		Started: time.Now().UTC(),
+		Entries: []JournalEntry{},
+		path:    path,
+	}
+}
+
+// LoadJournal reads the journal from the given path.
+func LoadJournal(path string) (*Journal, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	var j Journal
+	if err := json.Unmarshal(b, &j); err != nil {
+		return nil, fmt.Errorf("decoding journal %s: %w", path, err)
+	}
+	j.path = path
+	return &j, nil
+}
+
+// Entry returns the entry for the action with the given name and type.
+func (j *Journal) Entry(name string, typ ActionType) (JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if i := j.index(name, typ); i >= 0 {
+		return j.Entries[i], true
+	}
+	return JournalEntry{}, false
+}
+
+// Failed returns the entries of actions that failed, or never finished.
+func (j *Journal) Failed() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var failed []JournalEntry
+	for _, e := range j.Entries {
+		if e.Outcome == ActionOutcomeFailed ||
+			e.Outcome == ActionOutcomeRunning {
+			failed = append(failed, e)
+		}
+	}
+	return failed
+}
+
+// Report writes a human readable report of the journal to w.
+func (j *Journal) Report(w io.Writer) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "run %s started %s\n", j.RunID, j.Started.Format(time.RFC3339))
+	fmt.Fprintln(tw, "NAME\tTYPE\tENVIRONMENT\tOUTCOME\tDURATION\tPLAN\tERROR")
+	for _, e := range j.Entries {
+		var duration time.Duration
+		if !e.End.IsZero() {
+			duration = e.End.Sub(e.Start).Round(time.Millisecond)
+		}
+		env := "-"
+		if e.Environment != "" {
+			env = e.Environment
+		}
+		plan := "-"
+		if e.Plan != nil {
+			plan = e.Plan.String()
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Name, e.Type, env, e.Outcome, duration, plan, e.Error,
+		)
+	}
+	return tw.Flush()
+}
+
+// start records that the action has started.
+func (j *Journal) start(action Actioner) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := JournalEntry{
+		Name:        action.ActionName(),
+		Type:        action.ActionType(),
+		Environment: actionEnvironment(action),
+		Start:       time.Now().UTC(),
+		Outcome:     ActionOutcomeRunning,
+	}
+	if i := j.index(entry.Name, entry.Type); i >= 0 {
+		j.Entries[i] = entry
+	} else {
+		j.Entries = append(j.Entries, entry)
+	}
+	return j.save()
+}
+
+// finish records the outcome of the action.
+func (j *Journal) finish(
+	action Actioner,
+	outcome ActionOutcome,
+	actionErr error,
+) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i := j.index(action.ActionName(), action.ActionType())
+	if i < 0 {
+		j.Entries = append(j.Entries, JournalEntry{
+			Name:        action.ActionName(),
+			Type:        action.ActionType(),
+			Environment: actionEnvironment(action),
+			Start:       time.Now().UTC(),
+		})
+		i = len(j.Entries) - 1
+	}
+	entry := &j.Entries[i]
+	entry.End = time.Now().UTC()
+	entry.Outcome = outcome
+	entry.Error = ""
+	if actionErr != nil {
+		entry.Error = actionErr.Error()
+	}
+	if summarizer, ok := AsAction[PlanSummarizer](action); ok {
+		if summary, ok := summarizer.PlanSummary(); ok {
+			entry.Plan = &summary
+		}
+	}
+	return j.save()
+}
+
+func (j *Journal) index(name string, typ ActionType) int {
+	for i, e := range j.Entries {
+		if e.Name == name && e.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the journal to disk.
+// It writes to a temporary file first, so that the journal is never left half
+// written.
+func (j *Journal) save() error {
+	if j.path == "" {
+		return errors.New("journal has no path")
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), os.ModePerm); err != nil {
+		return fmt.Errorf("creating journal directory: %w", err)
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding journal: %w", err)
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+// ActionResolver returns the action for a journal entry, so that it can be
+// cleaned up by a process which did not run it.
+// Returning a nil action skips the entry.
+type ActionResolver func(entry JournalEntry) (Actioner, error)
+
+// TerraResolver returns an [ActionResolver] for terra actions.
+// The actions use the files exported by the previous run, so the original
+// stack is not needed to destroy them.
+// Entries of other action types are skipped.
+// Entries of actions in an environment cannot be resolved without it, so they
+// return an error: use [TerraEnvResolver] instead.
+func TerraResolver(opts ...TerraOption) ActionResolver {
+	return TerraEnvResolver(nil, opts...)
+}
+
+// TerraEnvResolver returns an [ActionResolver] for terra actions, like
+// [TerraResolver], which also resolves the actions run in one of the given
+// environments (see [WithTerraEnvironment]), so that they are destroyed in
+// their environment.
+// Entries of actions in an unknown environment return an error.
+func TerraEnvResolver(envs []Environment, opts ...TerraOption) ActionResolver {
+	return func(entry JournalEntry) (Actioner, error) {
+		if entry.Type != ActionTypeTerra {
+			return nil, nil
+		}
+		if entry.Environment == "" {
+			return Terra(entry.Name, &terra.Stack{}, opts...), nil
+		}
+		i := slices.IndexFunc(envs, func(env Environment) bool {
+			return env.Name == entry.Environment
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("unknown environment: %s", entry.Environment)
+		}
+		return Terra(
+			entry.Name,
+			&terra.Stack{},
+			append(slices.Clone(opts), WithTerraEnvironment(envs[i]))...,
+		), nil
+	}
+}
+
+// actionEnvironment returns the environment of the action, if any.
+func actionEnvironment(action Actioner) string {
+	if envAction, ok := AsAction[EnvironmentActioner](action); ok {
+		return envAction.ActionEnvironment()
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package sylt_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+)
+
+func TestJournalResume(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal.json")
+	errBoom := errors.New("boom")
+
+	var calls []string
+	newAction := func(name string, err error) *dummyAction {
+		return &dummyAction{
+			name: name,
+			runFn: func(ctx context.Context, opts sylt.RunOpts) error {
+				calls = append(calls, "run "+name)
+				return err
+			},
+			cleanupFn: func(ctx context.Context, opts sylt.RunOpts) error {
+				calls = append(calls, "cleanup "+name)
+				return nil
+			},
+		}
+	}
+
+	// First run fails on the second action.
+	wf := sylt.NewWorkflow(sylt.WithWorkflowJournal(path))
+	tu.AssertNoError(t, wf.Run(ctx, newAction("first", nil)))
+	err := wf.Run(ctx, newAction("second", errBoom))
+	tu.AssertEqual(t, true, errors.Is(err, errBoom))
+
+	journal, err := sylt.LoadJournal(path)
+	tu.AssertNoError(t, err)
+	failed := journal.Failed()
+	tu.AssertEqual(t, 1, len(failed))
+	tu.AssertEqual(t, "second", failed[0].Name)
+	tu.AssertEqual(t, "boom", failed[0].Error)
+
+	var report bytes.Buffer
+	tu.AssertNoError(t, journal.Report(&report))
+	tu.AssertEqual(t, true, strings.Contains(report.String(), "failed"))
+
+	// A process which only cleans up keeps the journal of the failed run.
+	tu.AssertNoError(t, sylt.NewWorkflow(
+		sylt.WithWorkflowJournal(path),
+		sylt.WithWorkflowDestroy(true),
+	).Cleanup(ctx))
+	journal, err = sylt.LoadJournal(path)
+	tu.AssertNoError(t, err)
+	tu.AssertEqual(t, 2, len(journal.Entries))
+
+	// Second run resumes from the failed action.
+	wf = sylt.NewWorkflow(
+		sylt.WithWorkflowJournal(path),
+		sylt.WithWorkflowResume(true),
+	)
+	tu.AssertNoError(t, wf.Run(ctx, newAction("first", nil)))
+	tu.AssertNoError(t, wf.Run(ctx, newAction("second", nil)))
+	tu.AssertEqualSlice(
+		t,
+		[]string{"run first", "run second", "run second"},
+		calls,
+	)
+
+	// A different process destroys what was recorded in the journal.
+	calls = nil
+	wf = sylt.NewWorkflow(
+		sylt.WithWorkflowJournal(path),
+		sylt.WithWorkflowDryRun(false),
+		sylt.WithWorkflowDestroy(true),
+	)
+	tu.AssertNoError(t, wf.CleanupJournal(
+		ctx,
+		func(entry sylt.JournalEntry) (sylt.Actioner, error) {
+			return newAction(entry.Name, nil), nil
+		},
+	))
+	tu.AssertEqualSlice(
+		t,
+		[]string{"cleanup second", "cleanup first"},
+		calls,
+	)
+	journal, err = sylt.LoadJournal(path)
+	tu.AssertNoError(t, err)
+	for _, entry := range journal.Entries {
+		tu.AssertEqual(t, sylt.ActionOutcomeDestroyed, entry.Outcome)
+	}
+}
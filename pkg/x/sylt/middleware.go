@@ -0,0 +1,254 @@
+package sylt
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Middleware wraps an action, e.g. to retry it or to log when it runs.
+// Middlewares can be set for all actions of a workflow with
+// [WithWorkflowMiddleware], or for a single action with [Use].
+//
+// Middlewares should return an [ActionWrapper], or another action
+// implementing `Unwrap() Actioner`, so that the workflow can still find the
+// interfaces implemented by the wrapped action, e.g. [DriftDetector].
+type Middleware func(next Actioner) Actioner
+
+var _ Actioner = (*ActionWrapper)(nil)
+
+// ActionWrapper wraps an action, overriding how it is run and cleaned up.
+// It is the building block for a [Middleware].
+type ActionWrapper struct {
+	Actioner
+	// RunFunc is called instead of the wrapped action's Run, if set.
+	RunFunc func(ctx context.Context, opts RunOpts) error
+	// CleanupFunc is called instead of the wrapped action's Cleanup, if set.
+	CleanupFunc func(ctx context.Context, opts RunOpts) error
+}
+
+func (w *ActionWrapper) Run(ctx context.Context, opts RunOpts) error {
+	if w.RunFunc == nil {
+		return w.Actioner.Run(ctx, opts)
+	}
+	return w.RunFunc(ctx, opts)
+}
+
+func (w *ActionWrapper) Cleanup(ctx context.Context, opts RunOpts) error {
+	if w.CleanupFunc == nil {
+		return w.Actioner.Cleanup(ctx, opts)
+	}
+	return w.CleanupFunc(ctx, opts)
+}
+
+// Unwrap returns the wrapped action.
+func (w *ActionWrapper) Unwrap() Actioner {
+	return w.Actioner
+}
+
+// Use wraps the action with the middlewares.
+// The first middleware is the outermost, i.e. it is called first.
+func Use(action Actioner, mid ...Middleware) Actioner {
+	for i := len(mid) - 1; i >= 0; i-- {
+		action = mid[i](action)
+	}
+	return action
+}
+
+// AsAction finds the first action in the chain of wrapped actions (see
+// [Middleware]) which implements I.
+func AsAction[I any](action Actioner) (I, bool) {
+	for action != nil {
+		if i, ok := action.(I); ok {
+			return i, true
+		}
+		u, ok := action.(interface{ Unwrap() Actioner })
+		if !ok {
+			break
+		}
+		action = u.Unwrap()
+	}
+	var z I
+	return z, false
+}
+
+// ActionPhase is the phase of an action that a middleware wraps.
+type ActionPhase string
+
+const (
+	ActionPhaseRun     ActionPhase = "run"
+	ActionPhaseCleanup ActionPhase = "cleanup"
+)
+
+// ActionEvent describes a phase of an action, for hooks.
+type ActionEvent struct {
+	ActionName string
+	ActionType ActionType
+	Phase      ActionPhase
+	Opts       RunOpts
+	// Start is when the phase started.
+	Start time.Time
+	// Duration and Err are only set after the phase finished.
+	Duration time.Duration
+	Err      error
+}
+
+// HooksMiddleware calls before and after each run and cleanup of an action,
+// e.g. to record metrics or send notifications.
+// If before returns an error, the action is not run and the error is
+// returned.
+// Either hook can be nil.
+func HooksMiddleware(
+	before func(ctx context.Context, ev ActionEvent) error,
+	after func(ctx context.Context, ev ActionEvent),
+) Middleware {
+	return func(next Actioner) Actioner {
+		hook := func(
+			phase ActionPhase,
+			fn func(ctx context.Context, opts RunOpts) error,
+		) func(ctx context.Context, opts RunOpts) error {
+			return func(ctx context.Context, opts RunOpts) error {
+				ev := ActionEvent{
+					ActionName: next.ActionName(),
+					ActionType: next.ActionType(),
+					Phase:      phase,
+					Opts:       opts,
+					Start:      time.Now(),
+				}
+				if before != nil {
+					if err := before(ctx, ev); err != nil {
+						return err
+					}
+				}
+				err := fn(ctx, opts)
+				if after != nil {
+					ev.Duration = time.Since(ev.Start)
+					ev.Err = err
+					after(ctx, ev)
+				}
+				return err
+			}
+		}
+		return &ActionWrapper{
+			Actioner:    next,
+			RunFunc:     hook(ActionPhaseRun, next.Run),
+			CleanupFunc: hook(ActionPhaseCleanup, next.Cleanup),
+		}
+	}
+}
+
+// LogMiddleware logs when each run and cleanup of an action starts and
+// finishes, with the duration and error (if any).
+func LogMiddleware(log *slog.Logger) Middleware {
+	return HooksMiddleware(
+		func(ctx context.Context, ev ActionEvent) error {
+			log.InfoContext(
+				ctx,
+				"action started",
+				"action_name", ev.ActionName,
+				"action_type", ev.ActionType,
+				"phase", ev.Phase,
+			)
+			return nil
+		},
+		func(ctx context.Context, ev ActionEvent) {
+			attrs := []any{
+				"action_name", ev.ActionName,
+				"action_type", ev.ActionType,
+				"phase", ev.Phase,
+				"duration", ev.Duration,
+			}
+			if ev.Err != nil {
+				log.ErrorContext(
+					ctx,
+					"action failed",
+					append(attrs, "err", ev.Err)...,
+				)
+				return
+			}
+			log.InfoContext(ctx, "action finished", attrs...)
+		},
+	)
+}
+
+// TimeoutMiddleware cancels each run and cleanup of an action that takes
+// longer than d.
+func TimeoutMiddleware(d time.Duration) Middleware {
+	return func(next Actioner) Actioner {
+		timeout := func(
+			fn func(ctx context.Context, opts RunOpts) error,
+		) func(ctx context.Context, opts RunOpts) error {
+			return func(ctx context.Context, opts RunOpts) error {
+				ctx, cancel := context.WithTimeout(ctx, d)
+				defer cancel()
+				return fn(ctx, opts)
+			}
+		}
+		return &ActionWrapper{
+			Actioner:    next,
+			RunFunc:     timeout(next.Run),
+			CleanupFunc: timeout(next.Cleanup),
+		}
+	}
+}
+
+// RetryMiddleware retries each run and cleanup of an action that fails, e.g.
+// because of transient provider errors.
+// It makes up to attempts attempts in total, waiting backoff before the first
+// retry and doubling it for each subsequent retry.
+//
+// The retryable function decides whether an error should be retried.
+// If it is nil, all errors are retried except [ErrApplyAborted],
+// [ErrDestroySkipped] and context cancellation.
+func RetryMiddleware(
+	attempts int,
+	backoff time.Duration,
+	retryable func(err error) bool,
+) Middleware {
+	if retryable == nil {
+		retryable = isRetryable
+	}
+	return func(next Actioner) Actioner {
+		retry := func(
+			fn func(ctx context.Context, opts RunOpts) error,
+		) func(ctx context.Context, opts RunOpts) error {
+			return func(ctx context.Context, opts RunOpts) error {
+				wait := backoff
+				for attempt := 1; ; attempt++ {
+					err := fn(ctx, opts)
+					if err == nil || attempt >= attempts || !retryable(err) {
+						return err
+					}
+					slog.WarnContext(
+						ctx,
+						"action failed, retrying",
+						"action_name", next.ActionName(),
+						"action_type", next.ActionType(),
+						"attempt", attempt,
+						"backoff", wait,
+						"err", err,
+					)
+					select {
+					case <-ctx.Done():
+						return errors.Join(err, ctx.Err())
+					case <-time.After(wait):
+					}
+					wait *= 2
+				}
+			}
+		}
+		return &ActionWrapper{
+			Actioner:    next,
+			RunFunc:     retry(next.Run),
+			CleanupFunc: retry(next.Cleanup),
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	return !errors.Is(err, ErrApplyAborted) &&
+		!errors.Is(err, ErrDestroySkipped) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,142 @@
+package sylt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+)
+
+var _ sylt.Actioner = (*flakyAction)(nil)
+
+// flakyAction fails the first failures times it is run or cleaned up.
+type flakyAction struct {
+	failures int
+	runs     int
+	cleanups int
+	calls    *[]string
+}
+
+func (a *flakyAction) ActionName() string          { return "flaky" }
+func (a *flakyAction) ActionType() sylt.ActionType { return "test" }
+
+func (a *flakyAction) Run(ctx context.Context, opts sylt.RunOpts) error {
+	a.runs++
+	*a.calls = append(*a.calls, "run")
+	if a.runs <= a.failures {
+		return errors.New("transient")
+	}
+	return nil
+}
+
+func (a *flakyAction) Cleanup(ctx context.Context, opts sylt.RunOpts) error {
+	a.cleanups++
+	*a.calls = append(*a.calls, "cleanup")
+	if a.cleanups <= a.failures {
+		return errors.New("transient")
+	}
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	var calls []string
+	hooks := func(name string) sylt.Middleware {
+		return sylt.HooksMiddleware(
+			func(ctx context.Context, ev sylt.ActionEvent) error {
+				calls = append(calls, name+" before "+string(ev.Phase))
+				return nil
+			},
+			func(ctx context.Context, ev sylt.ActionEvent) {
+				calls = append(calls, name+" after "+string(ev.Phase))
+			},
+		)
+	}
+	action := &flakyAction{failures: 1, calls: &calls}
+	wf := sylt.NewWorkflow(
+		sylt.WithWorkflowDryRun(false),
+		sylt.WithWorkflowDestroy(true),
+		sylt.WithWorkflowMiddleware(hooks("workflow")),
+	)
+	tu.AssertNoError(t, wf.Run(ctx, sylt.Use(
+		action,
+		hooks("action"),
+		sylt.RetryMiddleware(2, time.Millisecond, nil),
+	)))
+	tu.AssertNoError(t, wf.Cleanup(ctx))
+	tu.AssertEqualSlice(t, []string{
+		"workflow before run",
+		"action before run",
+		"run",
+		"run",
+		"action after run",
+		"workflow after run",
+		"workflow before cleanup",
+		"action before cleanup",
+		"cleanup",
+		"cleanup",
+		"action after cleanup",
+		"workflow after cleanup",
+	}, calls)
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	ctx := context.Background()
+	t.Run("exhausted", func(t *testing.T) {
+		var calls []string
+		action := &flakyAction{failures: 3, calls: &calls}
+		err := sylt.Use(
+			action,
+			sylt.RetryMiddleware(2, time.Millisecond, nil),
+		).Run(ctx, sylt.RunOpts{})
+		tu.AssertErrorMsg(t, err, "transient")
+		tu.AssertEqual(t, 2, action.runs)
+	})
+	t.Run("not retryable", func(t *testing.T) {
+		var calls []string
+		action := &flakyAction{failures: 1, calls: &calls}
+		err := sylt.Use(
+			action,
+			sylt.RetryMiddleware(
+				3,
+				time.Millisecond,
+				func(err error) bool { return false },
+			),
+		).Run(ctx, sylt.RunOpts{})
+		tu.AssertErrorMsg(t, err, "transient")
+		tu.AssertEqual(t, 1, action.runs)
+	})
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	action := sylt.Use(
+		&sylt.ActionWrapper{
+			Actioner: &flakyAction{},
+			RunFunc: func(ctx context.Context, opts sylt.RunOpts) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+		sylt.TimeoutMiddleware(time.Millisecond),
+	)
+	err := action.Run(context.Background(), sylt.RunOpts{})
+	tu.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestAsAction(t *testing.T) {
+	action := sylt.Terra("a", &terra.Stack{})
+	wrapped := sylt.Use(
+		action,
+		sylt.TimeoutMiddleware(time.Minute),
+		sylt.RetryMiddleware(2, time.Millisecond, nil),
+	)
+	depender, ok := sylt.AsAction[sylt.ActionDepender](wrapped)
+	tu.True(t, ok, "wrapped action should be an ActionDepender")
+	tu.True(t, depender == sylt.ActionDepender(action), "should find the wrapped action")
+	_, ok = sylt.AsAction[sylt.LockUpgrader](&flakyAction{})
+	tu.False(t, ok, "action should not be a LockUpgrader")
+}
@@ -0,0 +1,210 @@
+package sylt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const terraRemovedFile = "removed.tf"
+
+// ErrPruneChanges is returned when the plan to prune the state with `removed`
+// blocks has other changes than the removals, which were not approved.
+var ErrPruneChanges = errors.New("prune plan has other changes")
+
+// PruneMode defines how a [TerraAction] removes resources from the state
+// which are not in the stack (see [StackStateOverflow]).
+type PruneMode int
+
+const (
+	// PruneModeNone does not prune the state. This is the default.
+	PruneModeNone PruneMode = 0
+	// PruneModeRemovedBlocks generates `removed` blocks for the resources,
+	// which are planned and applied targeting only the removed resources.
+	// If the plan has any other change, pruning fails with
+	// [ErrPruneChanges].
+	// The resources are removed from the state but not destroyed.
+	PruneModeRemovedBlocks PruneMode = 1
+	// PruneModeStateRm runs `state rm` for the resources.
+	// The resources are removed from the state but not destroyed.
+	PruneModeStateRm PruneMode = 2
+)
+
+// PruneConfirmFunc is called with the resources to prune from the state.
+// The resources are only pruned if it returns true.
+type PruneConfirmFunc func(ctx context.Context, resources []StateResource) (bool, error)
+
+// WithTerraPrune removes resources from the state which are not in the stack,
+// using the given mode.
+// Pruning only happens when not running in dry run mode, and if confirm
+// returns true.
+// If the workflow has an [Approver], it must also approve the pruning.
+// Pruning must be confirmed: if confirm is nil and the workflow has no
+// [Approver], the resources are only listed (see
+// [TerraAction.OverflowResources]) and nothing is pruned.
+//
+// Resources removed from the state are not destroyed, so they will need to be
+// managed elsewhere, or deleted manually.
+func WithTerraPrune(mode PruneMode, confirm PruneConfirmFunc) TerraOption {
+	return func(o *terraOpts) {
+		o.pruneMode = mode
+		o.pruneConfirm = confirm
+	}
+}
+
+// OverflowResources returns the resources in the state which are not in the
+// stack, as found when the state was last imported.
+func (a *TerraAction[T]) OverflowResources() []StateResource {
+	if a.stateReport == nil {
+		return nil
+	}
+	return a.stateReport.Overflow
+}
+
+// prune removes the overflow resources from the state, depending on the prune
+// mode.
+// It returns true if the state was changed.
+func (a *TerraAction[T]) prune(
+	ctx context.Context,
+	approver Approver,
+) (bool, error) {
+	overflow := a.OverflowResources()
+	if a.opts.pruneMode == PruneModeNone || len(overflow) == 0 {
+		return false, nil
+	}
+	if a.opts.pruneConfirm == nil && approver == nil {
+		a.log.Info(
+			"prune requires confirmation or an approver, skipping",
+			"resources", overflow,
+		)
+		return false, nil
+	}
+	if a.opts.pruneConfirm != nil {
+		ok, err := a.opts.pruneConfirm(ctx, overflow)
+		if err != nil {
+			return false, fmt.Errorf("confirming prune: %w", err)
+		}
+		if !ok {
+			a.log.Info("prune not confirmed", "resources", overflow)
+			return false, nil
+		}
+	}
+	ok, err := approve(ctx, approver, ApprovalRequest{
+		ActionName: a.ActionName(),
+		ActionType: a.ActionType(),
+		Prune:      overflow,
+	})
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		a.log.Info("skipping prune", "resources", overflow)
+		return false, nil
+	}
+	a.log.Info("pruning state", "resources", overflow)
+	switch a.opts.pruneMode {
+	case PruneModeStateRm:
+		args := []string{"state", "rm"}
+		for _, res := range overflow {
+			args = append(args, res.Address)
+		}
+		if err := a.run(ctx, a.stdout, a.stderr, args...); err != nil {
+			return false, fmt.Errorf("running state rm command: %w", err)
+		}
+	case PruneModeRemovedBlocks:
+		return a.applyRemovedBlocks(ctx, overflow)
+	default:
+		return false, fmt.Errorf("unknown prune mode: %d", a.opts.pruneMode)
+	}
+	return true, nil
+}
+
+// applyRemovedBlocks writes `removed` blocks for the overflow resources next to
+// the exported stack, and plans and applies them.
+// The plan targets only the removed resources, as the approval only covers
+// them, and it is not applied if it has any other change.
+// It returns true if resources were removed from the state.
+// The file is removed afterwards, so that the resources can be added back to
+// the stack later.
+func (a *TerraAction[T]) applyRemovedBlocks(
+	ctx context.Context,
+	resources []StateResource,
+) (_ bool, err error) {
+	path := filepath.Join(a.dir(), terraRemovedFile)
+	if err := os.WriteFile(path, removedBlocks(resources), 0o644); err != nil {
+		return false, fmt.Errorf("writing removed blocks: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, os.Remove(path))
+	}()
+	// The plan of the stack is kept, as it decides whether the stack has
+	// changes.
+	stackPlan := a.plan
+	defer func() {
+		a.plan = stackPlan
+	}()
+	if _, err := a.runPlan(ctx, a.prunePlanArgs(resources)); err != nil {
+		return false, fmt.Errorf("planning removed blocks: %w", err)
+	}
+	if changes := changedAddresses(a.plan.out.ResourceChanges); len(changes) > 0 {
+		return false, fmt.Errorf(
+			"%w: %s",
+			ErrPruneChanges,
+			strings.Join(changes, ", "),
+		)
+	}
+	if len(forgottenAddresses(a.plan.out.ResourceChanges)) == 0 {
+		return false, nil
+	}
+	if err := a.Apply(ctx); err != nil {
+		return false, fmt.Errorf("applying removed blocks: %w", err)
+	}
+	return true, nil
+}
+
+// forgottenAddresses returns the addresses of the resources removed from the
+// state without being destroyed.
+func forgottenAddresses(changes []*tfjson.ResourceChange) []string {
+	var addrs []string
+	for _, res := range changes {
+		if res.Change != nil && res.Change.Actions.Forget() {
+			addrs = append(addrs, res.Address)
+		}
+	}
+	return addrs
+}
+
+// removedBlocks returns the HCL `removed` blocks for the given resources, which
+// remove them from the state without destroying them.
+// Removed blocks cannot refer to instances, so all instances of a resource are
+// removed with one block.
+func removedBlocks(resources []StateResource) []byte {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+	seen := map[string]bool{}
+	for _, res := range resources {
+		addr := res.ResourceAddress()
+		if seen[addr] {
+			continue
+		}
+		if len(seen) > 0 {
+			body.AppendNewline()
+		}
+		seen[addr] = true
+		block := body.AppendNewBlock("removed", nil)
+		block.Body().SetAttributeRaw(
+			"from",
+			hclwrite.TokensForIdentifier(addr),
+		)
+		lifecycle := block.Body().AppendNewBlock("lifecycle", nil)
+		lifecycle.Body().SetAttributeValue("destroy", cty.False)
+	}
+	return f.Bytes()
+}
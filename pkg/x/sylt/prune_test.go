@@ -0,0 +1,297 @@
+package sylt_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"github.com/golingon/lingon/pkg/x/sylt/sylttest"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func overflowState() tfjson.State {
+	return tfjson.State{
+		FormatVersion: "1.0",
+		Values: &tfjson.StateValues{
+			RootModule: &tfjson.StateModule{
+				Resources: []*tfjson.StateResource{
+					{
+						Address: "random_string.orphan",
+						Mode:    tfjson.ManagedResourceMode,
+						Type:    "random_string",
+						Name:    "orphan",
+					},
+					{
+						// Data sources are not part of the stack's state.
+						Address: "data.random_string.data",
+						Mode:    tfjson.DataResourceMode,
+						Type:    "random_string",
+						Name:    "data",
+					},
+				},
+			},
+		},
+	}
+}
+
+// prunePlan returns a plan removing the overflow resource from the state,
+// with the other given changes.
+func prunePlan(changes ...*tfjson.ResourceChange) tfjson.Plan {
+	return tfjson.Plan{
+		FormatVersion: "1.2",
+		ResourceChanges: append([]*tfjson.ResourceChange{{
+			Address: "random_string.orphan",
+			Change: &tfjson.Change{
+				Actions: tfjson.Actions{tfjson.ActionForget},
+			},
+		}}, changes...),
+	}
+}
+
+func TestStackStateOverflow(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	state := overflowState()
+	overflow, err := sylt.StackStateOverflow(&stack{}, &state)
+	tu.AssertNoError(t, err)
+	tu.AssertEqualSlice(t, []sylt.StateResource{
+		{Address: "random_string.orphan", Type: "random_string", Name: "orphan"},
+	}, overflow)
+}
+
+// removedRecorder records the removed blocks when planning.
+type removedRecorder struct {
+	*sylttest.Fake
+	removed string
+}
+
+func (r *removedRecorder) Run(ctx context.Context, cmd sylt.TerraCmd) error {
+	if sylttest.CommandKey(cmd.Args) == sylttest.KeyPlan {
+		b, err := os.ReadFile(filepath.Join(cmd.Dir, "removed.tf"))
+		if err == nil {
+			r.removed = string(b)
+		}
+	}
+	return r.Fake.Run(ctx, cmd)
+}
+
+func TestTerraPrune(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	newFake := func(t *testing.T, planDiff bool) *sylttest.Fake {
+		fake := sylttest.NewFake()
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, false, tfjson.Plan{
+			FormatVersion: "1.2",
+		}))
+		if planDiff {
+			tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, true, prunePlan()))
+		}
+		tu.AssertNoError(t, fake.State(overflowState()))
+		tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+		return fake
+	}
+	run := func(
+		t *testing.T,
+		cmder sylt.TerraCmder,
+		approver sylt.Approver,
+		opt sylt.TerraOption,
+	) *sylt.TerraAction[*stack] {
+		act := sylt.Terra(
+			"test",
+			&stack{},
+			sylt.WithTerraCmder(cmder),
+			sylt.WithTerraDir(t.TempDir()),
+			sylt.WithTerraOutput(io.Discard, io.Discard),
+			opt,
+		)
+		err := act.Run(context.Background(), sylt.RunOpts{
+			DryRun:   false,
+			Approver: approver,
+		})
+		tu.AssertNoError(t, err)
+		return act
+	}
+
+	t.Run("state rm", func(t *testing.T) {
+		fake := newFake(t, false)
+		var confirmed []sylt.StateResource
+		act := run(t, fake, nil, sylt.WithTerraPrune(
+			sylt.PruneModeStateRm,
+			func(ctx context.Context, res []sylt.StateResource) (bool, error) {
+				confirmed = res
+				return true, nil
+			},
+		))
+		tu.AssertEqual(t, 1, len(confirmed))
+		tu.AssertEqual(t, 0, len(act.OverflowResources()))
+		calls := fake.Calls()
+		tu.AssertEqualSlice(
+			t,
+			[]string{"state", "rm", "random_string.orphan"},
+			calls[4].Args,
+		)
+	})
+
+	t.Run("not confirmed", func(t *testing.T) {
+		fake := newFake(t, false)
+		act := run(t, fake, nil, sylt.WithTerraPrune(
+			sylt.PruneModeStateRm,
+			func(ctx context.Context, res []sylt.StateResource) (bool, error) {
+				return false, nil
+			},
+		))
+		tu.AssertEqual(t, 1, len(act.OverflowResources()))
+		for _, key := range fake.Keys() {
+			tu.IsNotEqual(t, "state", key)
+		}
+	})
+
+	t.Run("no confirmation", func(t *testing.T) {
+		fake := newFake(t, false)
+		act := run(t, fake, nil, sylt.WithTerraPrune(sylt.PruneModeStateRm, nil))
+		tu.AssertEqual(t, 1, len(act.OverflowResources()))
+		for _, key := range fake.Keys() {
+			tu.IsNotEqual(t, "state", key)
+		}
+	})
+
+	approveAll := sylt.ApproverFunc(func(
+		ctx context.Context,
+		req sylt.ApprovalRequest,
+	) (sylt.Decision, error) {
+		return sylt.DecisionApprove, nil
+	})
+
+	t.Run("removed blocks", func(t *testing.T) {
+		rec := &removedRecorder{Fake: newFake(t, true)}
+		act := run(t, rec, approveAll, sylt.WithTerraPrune(sylt.PruneModeRemovedBlocks, nil))
+		tu.AssertEqual(t, 0, len(act.OverflowResources()))
+		tu.AssertEqual(t, `removed {
+  from = random_string.orphan
+  lifecycle {
+    destroy = false
+  }
+}
+`, rec.removed)
+		tu.AssertEqualSlice(t, []string{
+			sylttest.KeyInit,
+			sylttest.KeyPlan,
+			sylttest.KeyShowPlan,
+			sylttest.KeyShowState,
+			sylttest.KeyPlan,
+			sylttest.KeyShowPlan,
+			sylttest.KeyApply,
+			sylttest.KeyShowState,
+		}, rec.Keys())
+		// The prune plan only targets the removed resources.
+		tu.AssertEqualSlice(
+			t,
+			[]string{"-target=random_string.orphan"},
+			targetArgs(rec.Calls()[4].Args),
+		)
+	})
+
+	// Only the prune is approved, the changes of the stack are not.
+	approvePrune := sylt.ApproverFunc(func(
+		ctx context.Context,
+		req sylt.ApprovalRequest,
+	) (sylt.Decision, error) {
+		if len(req.Prune) > 0 {
+			return sylt.DecisionApprove, nil
+		}
+		return sylt.DecisionSkip, nil
+	})
+	declined := &tfjson.ResourceChange{
+		Address: "random_string.declined",
+		Change: &tfjson.Change{
+			Actions: tfjson.Actions{tfjson.ActionUpdate},
+		},
+	}
+	newDeclinedFake := func(t *testing.T, prune tfjson.Plan) *sylttest.Fake {
+		fake := sylttest.NewFake()
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, true, tfjson.Plan{
+			FormatVersion:   "1.2",
+			ResourceChanges: []*tfjson.ResourceChange{declined},
+		}))
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, true, prune))
+		tu.AssertNoError(t, fake.State(overflowState()))
+		tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+		return fake
+	}
+
+	t.Run("declined apply", func(t *testing.T) {
+		fake := newDeclinedFake(t, prunePlan())
+		act := run(t, fake, approvePrune, sylt.WithTerraPrune(sylt.PruneModeRemovedBlocks, nil))
+		tu.AssertEqual(t, 0, len(act.OverflowResources()))
+		// The only apply is the one of the prune plan, which targets the
+		// removed resources.
+		keys := fake.Keys()
+		applies := 0
+		for i, key := range keys {
+			if key != sylttest.KeyApply {
+				continue
+			}
+			applies++
+			tu.AssertEqual(t, sylttest.KeyShowPlan, keys[i-1])
+			tu.AssertEqualSlice(
+				t,
+				[]string{"-target=random_string.orphan"},
+				targetArgs(fake.Calls()[i-2].Args),
+			)
+		}
+		tu.AssertEqual(t, 1, applies)
+		// The declined changes are still pending.
+		tu.True(t, act.HasChanges(), "declined changes should be pending")
+	})
+
+	t.Run("prune plan with other changes", func(t *testing.T) {
+		fake := newDeclinedFake(t, prunePlan(declined))
+		act := sylt.Terra(
+			"test",
+			&stack{},
+			sylt.WithTerraCmder(fake),
+			sylt.WithTerraDir(t.TempDir()),
+			sylt.WithTerraOutput(io.Discard, io.Discard),
+			sylt.WithTerraPrune(sylt.PruneModeRemovedBlocks, nil),
+		)
+		err := act.Run(context.Background(), sylt.RunOpts{Approver: approvePrune})
+		tu.ErrorIs(t, err, sylt.ErrPruneChanges)
+		tu.AssertErrorMsg(
+			t,
+			err,
+			"pruning state for stack test: prune plan has other changes: random_string.declined",
+		)
+		for _, key := range fake.Keys() {
+			tu.IsNotEqual(t, sylttest.KeyApply, key)
+		}
+	})
+
+	t.Run("nothing removed", func(t *testing.T) {
+		fake := newDeclinedFake(t, tfjson.Plan{FormatVersion: "1.2"})
+		act := run(t, fake, approvePrune, sylt.WithTerraPrune(sylt.PruneModeRemovedBlocks, nil))
+		// The state was not changed, so it is not imported again.
+		tu.AssertEqual(t, 1, len(act.OverflowResources()))
+		for _, key := range fake.Keys() {
+			tu.IsNotEqual(t, sylttest.KeyApply, key)
+		}
+	})
+}
+
+// targetArgs returns the -target arguments.
+func targetArgs(args []string) []string {
+	var targets []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-target=") {
+			targets = append(targets, arg)
+		}
+	}
+	return targets
+}
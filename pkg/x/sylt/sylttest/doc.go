@@ -0,0 +1,14 @@
+// Package sylttest provides utilities for testing sylt actions without a real
+// terra binary.
+//
+// A [Fake] implements [sylt.TerraCmder] and returns scripted outputs (e.g. plan
+// and state JSON) for each terra command.
+// A [Recorder] wraps a real [sylt.TerraCmder] and captures its outputs, which
+// can be saved as txtar fixtures and replayed later with [LoadFixture].
+//
+//	fake, err := sylttest.LoadFixture("testdata/network.txtar")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	act := sylt.Terra("network", stack, sylt.WithTerraCmder(fake))
+package sylttest
@@ -0,0 +1,192 @@
+package sylttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/golingon/lingon/pkg/x/sylt"
+)
+
+// Keys identifying terra commands, see [CommandKey].
+const (
+	KeyInit            = "init"
+	KeyPlan            = "plan"
+	KeyPlanDestroy     = "plan-destroy"
+	KeyPlanRefreshOnly = "plan-refresh-only"
+	KeyApply           = "apply"
+	KeyShowPlan        = "show-plan"
+	KeyShowState       = "show-state"
+)
+
+// CommandKey returns the key identifying the terra command with the given
+// arguments, e.g. "plan-destroy" for `plan -destroy -out=tfplan`.
+// Commands without a specific key use the name of the command, e.g. "init".
+func CommandKey(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	switch args[0] {
+	case "plan":
+		switch {
+		case slices.Contains(args, "-destroy"):
+			return KeyPlanDestroy
+		case slices.Contains(args, "-refresh-only"):
+			return KeyPlanRefreshOnly
+		}
+		return KeyPlan
+	case "show":
+		for _, arg := range args[1:] {
+			if !strings.HasPrefix(arg, "-") {
+				return KeyShowPlan
+			}
+		}
+		return KeyShowState
+	}
+	return args[0]
+}
+
+// Response is the scripted output of a terra command.
+type Response struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Call is an invocation of a terra command received by [Fake].
+type Call struct {
+	Key  string
+	Dir  string
+	Env  []string
+	Args []string
+}
+
+var _ sylt.TerraCmder = (*Fake)(nil)
+
+// Fake is a [sylt.TerraCmder] which returns scripted responses instead of
+// running terra.
+//
+// Responses are returned in the order they were scripted for each command key.
+// When all responses for a key have been used, the last one is repeated.
+// Commands without responses succeed with no output, except for show commands
+// which fail, as there is no sensible default.
+//
+// A Fake is safe for concurrent use.
+type Fake struct {
+	mu        sync.Mutex
+	responses map[string][]Response
+	calls     []Call
+}
+
+// NewFake creates a [Fake] without any scripted responses.
+func NewFake() *Fake {
+	return &Fake{
+		responses: map[string][]Response{},
+	}
+}
+
+// Script adds responses for the command key (see [CommandKey]).
+func (f *Fake) Script(key string, resp ...Response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[key] = append(f.responses[key], resp...)
+	return f
+}
+
+// Plan scripts a plan command with the key (e.g. [KeyPlan]), followed by
+// showing the given plan.
+// If the plan has changes, the plan command exits with code 2, as with the
+// `-detailed-exitcode` flag.
+func (f *Fake) Plan(key string, diff bool, plan any) error {
+	b, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("encoding plan: %w", err)
+	}
+	resp := Response{}
+	if diff {
+		resp.ExitCode = 2
+	}
+	f.Script(key, resp)
+	f.Script(KeyShowPlan, Response{Stdout: b})
+	return nil
+}
+
+// State scripts showing the given state.
+func (f *Fake) State(state any) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+	f.Script(KeyShowState, Response{Stdout: b})
+	return nil
+}
+
+// Calls returns the commands received by the fake, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// Keys returns the keys of the commands received by the fake, in order.
+func (f *Fake) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, len(f.calls))
+	for i, c := range f.calls {
+		keys[i] = c.Key
+	}
+	return keys
+}
+
+func (f *Fake) Run(ctx context.Context, cmd sylt.TerraCmd) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key := CommandKey(cmd.Args)
+	resp, ok := f.next(Call{
+		Key:  key,
+		Dir:  cmd.Dir,
+		Env:  slices.Clone(cmd.Env),
+		Args: slices.Clone(cmd.Args),
+	})
+	if !ok {
+		if key == KeyShowPlan || key == KeyShowState {
+			return fmt.Errorf("sylttest: no response for %q", key)
+		}
+		return nil
+	}
+	if cmd.Stdout != nil {
+		if _, err := cmd.Stdout.Write(resp.Stdout); err != nil {
+			return err
+		}
+	}
+	if cmd.Stderr != nil {
+		if _, err := cmd.Stderr.Write(resp.Stderr); err != nil {
+			return err
+		}
+	}
+	if resp.ExitCode != 0 {
+		return &sylt.TerraExitError{Code: resp.ExitCode}
+	}
+	return nil
+}
+
+// next records the call and returns the next response for it.
+func (f *Fake) next(call Call) (Response, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	queue := f.responses[call.Key]
+	switch len(queue) {
+	case 0:
+		return Response{}, false
+	case 1:
+		return queue[0], true
+	}
+	f.responses[call.Key] = queue[1:]
+	return queue[0], true
+}
@@ -0,0 +1,97 @@
+package sylttest_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"github.com/golingon/lingon/pkg/x/sylt/sylttest"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+type emptyStack struct {
+	terra.Stack
+}
+
+func runTerra(t *testing.T, cmder sylt.TerraCmder) {
+	t.Helper()
+	ctx := context.Background()
+	act := sylt.Terra(
+		"test",
+		&emptyStack{},
+		sylt.WithTerraCmder(cmder),
+		sylt.WithTerraDir(t.TempDir()),
+		sylt.WithTerraOutput(io.Discard, io.Discard),
+	)
+	wf := sylt.NewWorkflow(sylt.WithWorkflowDryRun(false))
+	tu.AssertNoError(t, wf.Run(ctx, act))
+}
+
+func TestFake(t *testing.T) {
+	fake := sylttest.NewFake()
+	tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, true, tfjson.Plan{
+		FormatVersion: "1.2",
+		ResourceChanges: []*tfjson.ResourceChange{
+			{
+				Address: "random_string.test",
+				Change: &tfjson.Change{
+					Actions: tfjson.Actions{tfjson.ActionCreate},
+				},
+			},
+		},
+	}))
+	tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+
+	runTerra(t, fake)
+	tu.AssertEqualSlice(
+		t,
+		[]string{
+			sylttest.KeyInit,
+			sylttest.KeyPlan,
+			sylttest.KeyShowPlan,
+			sylttest.KeyApply,
+			sylttest.KeyShowState,
+		},
+		fake.Keys(),
+	)
+}
+
+func TestLoadFixture(t *testing.T) {
+	fake, err := sylttest.LoadFixture(filepath.Join("testdata", "apply.txtar"))
+	tu.AssertNoError(t, err)
+
+	// Record the replayed fixture, and check that replaying the recording
+	// gives the same commands.
+	rec := sylttest.NewRecorder(fake)
+	runTerra(t, rec)
+	path := filepath.Join(t.TempDir(), "recorded.txtar")
+	tu.AssertNoError(t, rec.WriteFixture(path))
+
+	replay, err := sylttest.LoadFixture(path)
+	tu.AssertNoError(t, err)
+	runTerra(t, replay)
+	tu.AssertEqualSlice(t, fake.Keys(), replay.Keys())
+	tu.AssertEqual(t, sylttest.KeyApply, replay.Keys()[3])
+}
+
+func TestCommandKey(t *testing.T) {
+	tests := []struct {
+		args []string
+		key  string
+	}{
+		{[]string{"init", "-upgrade"}, sylttest.KeyInit},
+		{[]string{"plan", "-out=tfplan"}, sylttest.KeyPlan},
+		{[]string{"plan", "-out=tfplan", "-destroy"}, sylttest.KeyPlanDestroy},
+		{[]string{"plan", "-refresh-only"}, sylttest.KeyPlanRefreshOnly},
+		{[]string{"show", "-json", "tfplan"}, sylttest.KeyShowPlan},
+		{[]string{"show", "-json"}, sylttest.KeyShowState},
+		{[]string{"force-unlock", "-force", "id"}, "force-unlock"},
+	}
+	for _, tt := range tests {
+		tu.AssertEqual(t, tt.key, sylttest.CommandKey(tt.args))
+	}
+}
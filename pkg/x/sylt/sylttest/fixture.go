@@ -0,0 +1,235 @@
+package sylttest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"golang.org/x/tools/txtar"
+)
+
+// Fixtures are txtar archives with one file per output of a command:
+//
+//	-- 001-init.stdout --
+//	-- 002-plan.exitcode --
+//	2
+//	-- 003-show-plan.stdout --
+//	{"format_version":"1.2", ...}
+//
+// The number orders the commands, and the name is the command key (see
+// [CommandKey]).
+// Empty outputs and zero exit codes are omitted, unless a command has no
+// output at all, in which case its exit code is kept to record the command.
+const (
+	suffixStdout   = ".stdout"
+	suffixStderr   = ".stderr"
+	suffixExitCode = ".exitcode"
+)
+
+// LoadFixture reads a txtar fixture from the given path and returns a [Fake]
+// which replays it.
+func LoadFixture(path string) (*Fake, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading fixture: %w", err)
+	}
+	fake, err := ParseFixture(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing fixture %s: %w", path, err)
+	}
+	return fake, nil
+}
+
+// ParseFixture parses a txtar fixture and returns a [Fake] which replays it.
+func ParseFixture(data []byte) (*Fake, error) {
+	ar := txtar.Parse(data)
+	type step struct {
+		seq  int
+		key  string
+		resp Response
+	}
+	steps := map[int]*step{}
+	for _, f := range ar.Files {
+		name, suffix, ok := cutSuffix(f.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown fixture file: %s", f.Name)
+		}
+		seqStr, key, ok := strings.Cut(name, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid fixture file name: %s", f.Name)
+		}
+		seq, err := strconv.Atoi(seqStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fixture file name: %s", f.Name)
+		}
+		s, ok := steps[seq]
+		if !ok {
+			s = &step{seq: seq, key: key}
+			steps[seq] = s
+		}
+		if s.key != key {
+			return nil, fmt.Errorf(
+				"fixture %d has keys %q and %q", seq, s.key, key,
+			)
+		}
+		switch suffix {
+		case suffixStdout:
+			s.resp.Stdout = f.Data
+		case suffixStderr:
+			s.resp.Stderr = f.Data
+		case suffixExitCode:
+			code, err := strconv.Atoi(strings.TrimSpace(string(f.Data)))
+			if err != nil {
+				return nil, fmt.Errorf("invalid exit code in %s: %w", f.Name, err)
+			}
+			s.resp.ExitCode = code
+		}
+	}
+	ordered := make([]*step, 0, len(steps))
+	for _, s := range steps {
+		ordered = append(ordered, s)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].seq < ordered[j].seq
+	})
+	fake := NewFake()
+	for _, s := range ordered {
+		fake.Script(s.key, s.resp)
+	}
+	return fake, nil
+}
+
+func cutSuffix(name string) (string, string, bool) {
+	for _, suffix := range []string{suffixStdout, suffixStderr, suffixExitCode} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			return base, suffix, true
+		}
+	}
+	return "", "", false
+}
+
+var _ sylt.TerraCmder = (*Recorder)(nil)
+
+// Recorder wraps a [sylt.TerraCmder] (typically a real terra binary) and
+// records the outputs of the commands, so that they can be saved as a fixture
+// and replayed with a [Fake].
+type Recorder struct {
+	cmder sylt.TerraCmder
+
+	mu    sync.Mutex
+	steps []recordedStep
+}
+
+type recordedStep struct {
+	key  string
+	resp Response
+}
+
+// NewRecorder creates a [Recorder] wrapping the given [sylt.TerraCmder].
+func NewRecorder(cmder sylt.TerraCmder) *Recorder {
+	return &Recorder{cmder: cmder}
+}
+
+func (r *Recorder) Run(ctx context.Context, cmd sylt.TerraCmd) error {
+	var stdout, stderr bytes.Buffer
+	recCmd := cmd
+	recCmd.Stdout = teeWriter(&stdout, cmd.Stdout)
+	recCmd.Stderr = teeWriter(&stderr, cmd.Stderr)
+	err := r.cmder.Run(ctx, recCmd)
+
+	resp := Response{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
+	}
+	if err != nil {
+		code, ok := exitCode(err)
+		if !ok {
+			// Not a command failure, so there is nothing to replay.
+			return err
+		}
+		resp.ExitCode = code
+	}
+	r.mu.Lock()
+	r.steps = append(r.steps, recordedStep{
+		key:  CommandKey(cmd.Args),
+		resp: resp,
+	})
+	r.mu.Unlock()
+	return err
+}
+
+// Archive returns the recorded outputs as a txtar archive.
+func (r *Recorder) Archive() *txtar.Archive {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ar := txtar.Archive{
+		Comment: []byte("Recorded by sylttest.Recorder.\n"),
+	}
+	for i, s := range r.steps {
+		name := fmt.Sprintf("%03d-%s", i+1, s.key)
+		if len(s.resp.Stdout) > 0 {
+			ar.Files = append(ar.Files, txtar.File{
+				Name: name + suffixStdout,
+				Data: withNewline(s.resp.Stdout),
+			})
+		}
+		if len(s.resp.Stderr) > 0 {
+			ar.Files = append(ar.Files, txtar.File{
+				Name: name + suffixStderr,
+				Data: withNewline(s.resp.Stderr),
+			})
+		}
+		if s.resp.ExitCode != 0 || (len(s.resp.Stdout) == 0 &&
+			len(s.resp.Stderr) == 0) {
+			ar.Files = append(ar.Files, txtar.File{
+				Name: name + suffixExitCode,
+				Data: []byte(strconv.Itoa(s.resp.ExitCode) + "\n"),
+			})
+		}
+	}
+	return &ar
+}
+
+// WriteFixture writes the recorded outputs as a txtar fixture to the given
+// path.
+func (r *Recorder) WriteFixture(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("creating fixture directory: %w", err)
+	}
+	if err := os.WriteFile(path, txtar.Format(r.Archive()), 0o644); err != nil {
+		return fmt.Errorf("writing fixture: %w", err)
+	}
+	return nil
+}
+
+// withNewline makes sure the data ends with a newline, as required by txtar.
+func withNewline(b []byte) []byte {
+	if len(b) == 0 || b[len(b)-1] == '\n' {
+		return b
+	}
+	return append(b, '\n')
+}
+
+func teeWriter(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
+
+func exitCode(err error) (int, bool) {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
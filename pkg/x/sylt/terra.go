@@ -6,10 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/golingon/lingon/pkg/terra"
 	tfjson "github.com/hashicorp/terraform-json"
@@ -24,21 +25,142 @@ const ActionTypeTerra ActionType = "terra"
 
 type TerraOption func(*terraOpts)
 
+// WithTerraCmd sets the terra binary to run, e.g. `tofu` or `terraform`.
+// It is ignored if a [TerraCmder] is set with [WithTerraCmder].
 func WithTerraCmd(cmd string) TerraOption {
 	return func(o *terraOpts) {
 		o.cmd = cmd
 	}
 }
 
+// WithTerraCmder sets the [TerraCmder] used to run terra commands.
+func WithTerraCmder(cmder TerraCmder) TerraOption {
+	return func(o *terraOpts) {
+		o.cmder = cmder
+	}
+}
+
+// WithTerraEnv adds environment variables, in the form "KEY=value", to the
+// terra commands run by the action.
+func WithTerraEnv(env ...string) TerraOption {
+	return func(o *terraOpts) {
+		o.env = append(o.env, env...)
+	}
+}
+
+// WithTerraDir overrides the working directory of the action, which defaults
+// to `.lingon/terra/<name>`.
+func WithTerraDir(dir string) TerraOption {
+	return func(o *terraOpts) {
+		o.dir = dir
+	}
+}
+
+// WithTerraEnvironment deploys the stack to the environment.
+// The working directory of the action becomes `.lingon/terra/<env>/<name>`,
+// its state key is prefixed with the environment name (see [StateKey]) and
+// the backend of the environment is used, unless set with [WithTerraBackend].
+func WithTerraEnvironment(env Environment) TerraOption {
+	return func(o *terraOpts) {
+		o.environment = &env
+	}
+}
+
+// WithTerraOutput sets where the output of the terra commands is written.
+// It defaults to [os.Stdout] and [os.Stderr].
+func WithTerraOutput(stdout, stderr io.Writer) TerraOption {
+	return func(o *terraOpts) {
+		o.stdout = stdout
+		o.stderr = stderr
+	}
+}
+
+// WithTerraOutputPrefix sets the prefix for each line of output of the terra
+// commands.
+// It defaults to the action name in brackets, e.g. "[network] ".
+// An empty prefix disables prefixing.
+func WithTerraOutputPrefix(prefix string) TerraOption {
+	return func(o *terraOpts) {
+		o.prefix = &prefix
+	}
+}
+
+// WithTerraTargets limits the plan to the given resources, and their
+// dependencies, by passing `-target` to terra.
+// The resources must be part of the stack.
+func WithTerraTargets(res ...terra.Resource) TerraOption {
+	return func(o *terraOpts) {
+		o.targets = append(o.targets, res...)
+	}
+}
+
+// WithTerraReplace forces the given resources to be replaced, by passing
+// `-replace` to terra.
+// The resources must be part of the stack.
+func WithTerraReplace(res ...terra.Resource) TerraOption {
+	return func(o *terraOpts) {
+		o.replace = append(o.replace, res...)
+	}
+}
+
+// WithTerraRefresh sets whether terra refreshes the state before planning.
+// Refresh is enabled by default, and disabling it passes `-refresh=false`.
+func WithTerraRefresh(b bool) TerraOption {
+	return func(o *terraOpts) {
+		o.noRefresh = !b
+	}
+}
+
+// WithTerraParallelism limits the number of concurrent operations terra
+// performs during plan and apply, by passing `-parallelism`.
+func WithTerraParallelism(n int) TerraOption {
+	return func(o *terraOpts) {
+		o.parallelism = n
+	}
+}
+
+// WithTerraLockTimeout sets how long terra waits to acquire the state lock
+// during plan and apply, by passing `-lock-timeout`.
+func WithTerraLockTimeout(d time.Duration) TerraOption {
+	return func(o *terraOpts) {
+		o.lockTimeout = d
+	}
+}
+
 type terraOpts struct {
 	enableCache bool
 	cmd         string
+	cmder       TerraCmder
+	env         []string
+	dir         string
+	stdout      io.Writer
+	stderr      io.Writer
+	prefix      *string
+
+	targets      []terra.Resource
+	replace      []terra.Resource
+	noRefresh    bool
+	parallelism  int
+	lockTimeout  time.Duration
+	lockAttempts int
+	lockBackoff  time.Duration
+
+	backend     func(key string) terra.Backend
+	lockFile    string
+	environment *Environment
+
+	pruneMode    PruneMode
+	pruneConfirm PruneConfirmFunc
+
+	stateAddress StateAddressFunc
 }
 
 var defaultTerraOpts = func() terraOpts {
 	return terraOpts{
 		enableCache: false,
 		cmd:         "tofu",
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
 	}
 }
 
@@ -53,15 +175,25 @@ func Terra[T terra.Exporter](
 		o(&opt)
 	}
 
-	cmd := terraCmd{
-		cmd: opt.cmd,
+	cmder := opt.cmder
+	if cmder == nil {
+		cmder = &ExecTerraCmder{Bin: opt.cmd}
+	}
+	prefix := "[" + name + "] "
+	if opt.environment != nil {
+		prefix = "[" + opt.environment.Name + "/" + name + "] "
+	}
+	if opt.prefix != nil {
+		prefix = *opt.prefix
 	}
 
 	act := TerraAction[T]{
-		Name:  name,
-		Stack: stack,
-		opts:  opt,
-		cmd:   &cmd,
+		Name:   name,
+		Stack:  stack,
+		opts:   opt,
+		cmd:    cmder,
+		stdout: newPrefixWriter(opt.stdout, prefix),
+		stderr: newPrefixWriter(opt.stderr, prefix),
 	}
 	act.log = slog.With(
 		"action_name",
@@ -71,10 +203,21 @@ func Terra[T terra.Exporter](
 		"dir",
 		act.dir(),
 	)
+	if opt.environment != nil {
+		act.log = act.log.With("env", opt.environment.Name)
+	}
 	return &act
 }
 
-var _ Actioner = (*TerraAction[*terra.Stack])(nil)
+var (
+	_ Actioner       = (*TerraAction[*terra.Stack])(nil)
+	_ DriftDetector  = (*TerraAction[*terra.Stack])(nil)
+	_ PlanSummarizer = (*TerraAction[*terra.Stack])(nil)
+	_ ActionDepender = (*TerraAction[*terra.Stack])(nil)
+	_ LockUpgrader   = (*TerraAction[*terra.Stack])(nil)
+
+	_ EnvironmentActioner = (*TerraAction[*terra.Stack])(nil)
+)
 
 // TerraAction is an action that performs terra commands on a stack.
 // It implements the [Actioner] interface so can be used together with a
@@ -91,9 +234,16 @@ type TerraAction[T terra.Exporter] struct {
 	opts terraOpts
 
 	log         *slog.Logger
-	cmd         terraCmder
+	cmd         TerraCmder
+	stdout      io.Writer
+	stderr      io.Writer
 	stateStatus StateStatus
 	plan        *plan
+	drift       *DriftResult
+	inputs      []terraInput
+	// skipped is set when a resumed workflow skipped the action.
+	skipped     bool
+	stateReport *StateReport
 }
 
 func (a *TerraAction[T]) ActionName() string {
@@ -104,6 +254,15 @@ func (a *TerraAction[T]) ActionType() ActionType {
 	return ActionTypeTerra
 }
 
+// ActionEnvironment returns the name of the environment of the action, or an
+// empty string if it has none (see [WithTerraEnvironment]).
+func (a *TerraAction[T]) ActionEnvironment() string {
+	if a.opts.environment == nil {
+		return ""
+	}
+	return a.opts.environment.Name
+}
+
 func (a *TerraAction[T]) Run(ctx context.Context, opts RunOpts) error {
 	if a.Name == "" {
 		return ErrMissingActionName
@@ -111,8 +270,18 @@ func (a *TerraAction[T]) Run(ctx context.Context, opts RunOpts) error {
 
 	runLog := a.log.With("run_opts", opts)
 
+	if err := a.validateOpts(); err != nil {
+		return err
+	}
+	if err := a.resolveInputs(ctx); err != nil {
+		return err
+	}
+
 	runLog.Info("exporting stack")
-	if err := a.Export(); err != nil {
+	_, span := a.startPhaseSpan(ctx, "export")
+	err := a.Export()
+	span.End(ctx, err)
+	if err != nil {
 		return err
 	}
 
@@ -136,6 +305,21 @@ func (a *TerraAction[T]) Run(ctx context.Context, opts RunOpts) error {
 		}
 	}
 
+	// In drift mode nothing is applied, we only compare the stack with the
+	// actual infrastructure.
+	if opts.Drift {
+		runLog.Info("detecting drift")
+		result, err := a.DetectDrift(ctx)
+		if err != nil {
+			return fmt.Errorf(
+				"detecting drift for stack %s: %w",
+				a.Name, err,
+			)
+		}
+		runLog.Info("detected drift", "status", result.Status)
+		return nil
+	}
+
 	// If the action is marked for destruction, skip the plan and apply.
 	// We only need to show the state.
 	if opts.Destroy {
@@ -164,11 +348,19 @@ func (a *TerraAction[T]) Run(ctx context.Context, opts RunOpts) error {
 	}
 	// Apply if there is a diff AND not dry run.
 	if diff && !opts.DryRun {
-		runLog.Info("applying stack")
-		if err := a.Apply(ctx); err != nil {
-			return fmt.Errorf(
-				"applying stack %s: %w", a.Name, err,
-			)
+		ok, err := approve(ctx, opts.Approver, a.approvalRequest(false))
+		if err != nil {
+			return err
+		}
+		if ok {
+			runLog.Info("applying stack")
+			if err := a.Apply(ctx); err != nil {
+				return fmt.Errorf(
+					"applying stack %s: %w", a.Name, err,
+				)
+			}
+		} else {
+			runLog.Info("skipping apply")
 		}
 	}
 
@@ -179,6 +371,24 @@ func (a *TerraAction[T]) Run(ctx context.Context, opts RunOpts) error {
 			a.Name, err,
 		)
 	}
+	if overflow := a.OverflowResources(); len(overflow) > 0 {
+		runLog.Warn("state has resources not in stack", "resources", overflow)
+	}
+	if !opts.DryRun {
+		pruned, err := a.prune(ctx, opts.Approver)
+		if err != nil {
+			return fmt.Errorf("pruning state for stack %s: %w", a.Name, err)
+		}
+		if pruned {
+			runLog.Info("importing pruned state into stack")
+			if err := a.ImportState(ctx); err != nil {
+				return fmt.Errorf(
+					"getting state for stack %s: %w",
+					a.Name, err,
+				)
+			}
+		}
+	}
 	// Only write the md5 checksum if the stack has no changes and caching is
 	// enabled.
 	if !a.HasChanges() && a.opts.enableCache {
@@ -192,6 +402,7 @@ func (a *TerraAction[T]) Run(ctx context.Context, opts RunOpts) error {
 
 // Cleanup destroys the stack if the destroy option is set.
 // It honours the dry run option.
+// If the [Approver] skips the destroy, it returns [ErrDestroySkipped].
 func (a *TerraAction[T]) Cleanup(ctx context.Context, opts RunOpts) error {
 	a.log.Info("running cleanup")
 	if err := a.Init(ctx); err != nil {
@@ -209,6 +420,14 @@ func (a *TerraAction[T]) Cleanup(ctx context.Context, opts RunOpts) error {
 	if opts.DryRun || !diff {
 		return nil
 	}
+	ok, err := approve(ctx, opts.Approver, a.approvalRequest(true))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		a.log.Info("skipping destroy")
+		return fmt.Errorf("%w: %s", ErrDestroySkipped, a.ActionName())
+	}
 	// Apply the stack with above plan which passed the destroy flag.
 	if err := a.Apply(ctx); err != nil {
 		return fmt.Errorf(
@@ -238,8 +457,10 @@ func (a *TerraAction[T]) Cleanup(ctx context.Context, opts RunOpts) error {
 // Being in sync means there is no drift.
 // This is best effort: things can always change between the time terra plan and
 // apply were run.
+//
+// If the state has resources which are not in the stack (see
+// [TerraAction.OverflowResources]), the stack is considered to have changes.
 func (a *TerraAction[T]) HasChanges() bool {
-	// TODO: what about if the state has things that are not in the stack??
 	if a.stateStatus != StateStatusSync {
 		return true
 	}
@@ -257,20 +478,55 @@ func (a *TerraAction[T]) HasChanges() bool {
 	return false
 }
 
+// PlanSummary returns the summary of the last plan, if any.
+func (a *TerraAction[T]) PlanSummary() (PlanSummary, bool) {
+	if a.plan == nil {
+		return PlanSummary{}, false
+	}
+	return a.plan.summary(), true
+}
+
+// StateReport returns the report of how the state matched the stack, when the
+// state was last imported.
+// It returns nil if the state has not been imported.
+func (a *TerraAction[T]) StateReport() *StateReport {
+	return a.stateReport
+}
+
+// approvalRequest returns the request to approve the last plan.
+func (a *TerraAction[T]) approvalRequest(destroy bool) ApprovalRequest {
+	req := ApprovalRequest{
+		ActionName: a.ActionName(),
+		ActionType: a.ActionType(),
+		Destroy:    destroy,
+	}
+	if a.plan != nil {
+		req.Plan = a.plan.summary()
+		req.Changes = changedAddresses(a.plan.out.ResourceChanges)
+	}
+	return req
+}
+
 // Export exports the stack to HCL.
 func (a *TerraAction[T]) Export() error {
-	if err := terra.Export(
-		a.Stack,
+	exportOpts := []terra.ExportOption{
 		terra.WithExportOutputDirectory(a.dir()),
-	); err != nil {
+	}
+	if backend := a.backend(envStateKey(a.ActionEnvironment(), a.Name)); backend != nil {
+		exportOpts = append(exportOpts, terra.WithExportBackend(backend))
+	}
+	if err := terra.Export(a.Stack, exportOpts...); err != nil {
 		return fmt.Errorf("exporting stack: %w", err)
 	}
 	return nil
 }
 
 // Apply runs the terra apply command.
-func (a *TerraAction[T]) Apply(ctx context.Context) error {
-	if err := a.cmd.Run(ctx, a.dir(), os.Stdout, os.Stderr, terraCallApply...); err != nil {
+func (a *TerraAction[T]) Apply(ctx context.Context) (err error) {
+	ctx, span := a.startPhaseSpan(ctx, "apply")
+	defer func() { span.End(ctx, err) }()
+
+	if err := a.run(ctx, a.stdout, a.stderr, a.applyArgs()...); err != nil {
 		return fmt.Errorf("running apply command: %w", err)
 	}
 	// Mark the plan as applied.
@@ -297,20 +553,37 @@ func (a *TerraAction[T]) PlanDestroy(
 func (a *TerraAction[T]) planWithDestroy(
 	ctx context.Context,
 	destroy bool,
-) (bool, error) {
+) (diff bool, err error) {
+	phase := "plan"
+	if destroy {
+		phase = "plan-destroy"
+	}
+	ctx, span := a.startPhaseSpan(ctx, phase)
+	defer func() {
+		span.SetAttr("diff", diff)
+		span.End(ctx, err)
+	}()
+
 	planArgs := terraCallPlan
 	if destroy {
 		planArgs = terraCallPlanDestroy
 	}
+	return a.runPlan(ctx, a.planArgs(planArgs))
+}
+
+// runPlan runs the terra plan command with the given arguments and imports the
+// plan into the stack.
+func (a *TerraAction[T]) runPlan(
+	ctx context.Context,
+	planArgs []string,
+) (bool, error) {
 	doPlan := func() (bool, error) {
-		if err := a.cmd.Run(ctx, a.dir(), os.Stdout, os.Stderr, planArgs...); err != nil {
-			if exitError, ok := err.(*exec.ExitError); ok {
-				// When passing the -detailed-exitcode flag to the plan command,
-				// exit code 2 means no errors but there is a diff.
-				// https://developer.hashicorp.com/terraform/cli/commands/plan#detailed-exitcode
-				if exitError.ExitCode() == 2 {
-					return true, nil
-				}
+		if err := a.run(ctx, a.stdout, a.stderr, planArgs...); err != nil {
+			// When passing the -detailed-exitcode flag to the plan command,
+			// exit code 2 means no errors but there is a diff.
+			// https://developer.hashicorp.com/terraform/cli/commands/plan#detailed-exitcode
+			if code, ok := exitCode(err); ok && code == 2 {
+				return true, nil
 			}
 			return false, fmt.Errorf("running plan command: %w", err)
 		}
@@ -329,18 +602,34 @@ func (a *TerraAction[T]) planWithDestroy(
 }
 
 // Init runs the terra init command.
-func (a *TerraAction[T]) Init(ctx context.Context) error {
+// Providers are only upgraded if there is no dependency lock file, see
+// [WithTerraLockFile].
+func (a *TerraAction[T]) Init(ctx context.Context) (err error) {
+	ctx, span := a.startPhaseSpan(ctx, "init")
+	defer func() { span.End(ctx, err) }()
+
+	if err := a.restoreLockFile(); err != nil {
+		return err
+	}
+	args, err := a.initArgs()
+	if err != nil {
+		return err
+	}
+	return a.init(ctx, args)
+}
+
+func (a *TerraAction[T]) init(ctx context.Context, args []string) error {
 	out := bytes.Buffer{}
-	if err := a.cmd.Run(ctx, a.dir(), &out, &out, terraCallInit...); err != nil {
-		fmt.Fprint(os.Stderr, out.String())
+	if err := a.run(ctx, &out, &out, args...); err != nil {
+		fmt.Fprint(a.stderr, out.String())
 		return fmt.Errorf("running init command: %w", err)
 	}
-	return nil
+	return a.persistLockFile()
 }
 
 func (a *TerraAction[T]) showPlan(ctx context.Context) error {
 	var buf bytes.Buffer
-	if err := a.cmd.Run(ctx, a.dir(), &buf, os.Stderr, terraCallShowPlan...); err != nil {
+	if err := a.run(ctx, &buf, a.stderr, terraCallShowPlan...); err != nil {
 		return fmt.Errorf("running show command: %w", err)
 	}
 
@@ -361,10 +650,60 @@ func (a *TerraAction[T]) showPlan(ctx context.Context) error {
 	return nil
 }
 
+// DetectDrift compares the stack with the actual infrastructure without
+// applying anything.
+// It runs a refresh-only plan to find changes made outside of terra, then a
+// normal plan to find pending changes in the stack, and finally imports the
+// state into the stack.
+// The result is also available afterwards via [TerraAction.DriftResult].
+func (a *TerraAction[T]) DetectDrift(
+	ctx context.Context,
+) (_ *DriftResult, err error) {
+	ctx, span := a.startPhaseSpan(ctx, "drift")
+	defer func() { span.End(ctx, err) }()
+
+	if _, err := a.runPlan(ctx, a.planArgs(terraCallPlanRefreshOnly)); err != nil {
+		return nil, fmt.Errorf("planning refresh-only: %w", err)
+	}
+	drifted := changedAddresses(a.plan.out.ResourceDrift)
+
+	if _, err := a.Plan(ctx); err != nil {
+		return nil, fmt.Errorf("planning: %w", err)
+	}
+	pending := changedAddresses(a.plan.out.ResourceChanges)
+
+	if err := a.ImportState(ctx); err != nil {
+		return nil, fmt.Errorf("importing state: %w", err)
+	}
+
+	result := DriftResult{
+		ActionName:  a.ActionName(),
+		ActionType:  a.ActionType(),
+		Status:      driftStatus(a.stateStatus, drifted, pending),
+		StateStatus: a.stateStatus,
+		Drifted:     drifted,
+		Pending:     pending,
+		Overflow:    a.OverflowResources(),
+	}
+	a.drift = &result
+	return &result, nil
+}
+
+// DriftResult returns the result of the last drift detection, if any.
+func (a *TerraAction[T]) DriftResult() (DriftResult, bool) {
+	if a.drift == nil {
+		return DriftResult{}, false
+	}
+	return *a.drift, true
+}
+
 // ImportState runs `terra show` and imports the state into the stack.
-func (a *TerraAction[T]) ImportState(ctx context.Context) error {
+func (a *TerraAction[T]) ImportState(ctx context.Context) (err error) {
+	ctx, span := a.startPhaseSpan(ctx, "import-state")
+	defer func() { span.End(ctx, err) }()
+
 	var buf bytes.Buffer
-	if err := a.cmd.Run(ctx, a.dir(), &buf, os.Stderr, "show", "-json"); err != nil {
+	if err := a.run(ctx, &buf, a.stderr, terraCallShowState...); err != nil {
 		return fmt.Errorf("running show command: %w", err)
 	}
 
@@ -385,21 +724,37 @@ func (a *TerraAction[T]) ImportState(ctx context.Context) error {
 	return nil
 }
 
+// run runs the terra command with the given arguments in the action's
+// directory.
+func (a *TerraAction[T]) run(
+	ctx context.Context,
+	stdout io.Writer,
+	stderr io.Writer,
+	args ...string,
+) error {
+	return a.runWithLockRetry(ctx, stdout, stderr, args...)
+}
+
 func (a *TerraAction[T]) dir() string {
+	if a.opts.dir != "" {
+		return a.opts.dir
+	}
 	return filepath.Join(
 		".lingon",
 		"terra",
+		a.ActionEnvironment(),
 		a.Name,
 	)
 }
 
 // importStateIntoStack imports the given state into the stack.
 func (a *TerraAction[T]) importStateIntoStack(state *tfjson.State) error {
-	stateStatus, err := StackImportState(a.Stack, state)
+	report, err := importStateReport(a.Stack, state, a.opts.stateAddress)
 	if err != nil {
 		return fmt.Errorf("importing state: %w", err)
 	}
-	a.stateStatus = stateStatus
+	a.stateStatus = report.Status
+	a.stateReport = report
 	return nil
 }
 
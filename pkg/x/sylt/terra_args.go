@@ -0,0 +1,111 @@
+package sylt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/golingon/lingon/pkg/terra"
+)
+
+var ErrResourceNotInStack = errors.New("resource not in stack")
+
+// validateOpts checks the options of the action against its stack.
+func (a *TerraAction[T]) validateOpts() error {
+	if a.opts.parallelism < 0 {
+		return fmt.Errorf(
+			"invalid parallelism %d: must be positive", a.opts.parallelism,
+		)
+	}
+	if a.opts.lockTimeout < 0 {
+		return fmt.Errorf(
+			"invalid lock timeout %s: must be positive", a.opts.lockTimeout,
+		)
+	}
+	if len(a.opts.targets) == 0 && len(a.opts.replace) == 0 {
+		return nil
+	}
+	sb, err := terra.ObjectsFromStack(a.Stack)
+	if err != nil {
+		return fmt.Errorf("getting stack objects: %w", err)
+	}
+	inStack := func(res terra.Resource) bool {
+		return slices.ContainsFunc(sb.Resources, func(sr terra.Resource) bool {
+			return sr.Type() == res.Type() && sr.LocalName() == res.LocalName()
+		})
+	}
+	for _, res := range slices.Concat(a.opts.targets, a.opts.replace) {
+		if !inStack(res) {
+			return fmt.Errorf(
+				"%w: %s", ErrResourceNotInStack, resourceAddress(res),
+			)
+		}
+	}
+	return nil
+}
+
+// planArgs returns the arguments for the given plan call with the options of
+// the action.
+// Options which are not compatible with the plan mode (e.g. replacing
+// resources when destroying) are left out.
+func (a *TerraAction[T]) planArgs(call []string) []string {
+	args := slices.Clone(call)
+	destroy := slices.Contains(call, "-destroy")
+	refreshOnly := slices.Contains(call, "-refresh-only")
+	for _, res := range a.opts.targets {
+		args = append(args, "-target="+resourceAddress(res))
+	}
+	if !destroy && !refreshOnly {
+		for _, res := range a.opts.replace {
+			args = append(args, "-replace="+resourceAddress(res))
+		}
+	}
+	if a.opts.noRefresh && !refreshOnly {
+		args = append(args, "-refresh=false")
+	}
+	return append(args, a.commonArgs()...)
+}
+
+// prunePlanArgs returns the arguments for planning the `removed` blocks of the
+// given resources.
+// The plan targets only the removed resources, so that it does not include
+// other changes to the stack, e.g. those which were not approved.
+func (a *TerraAction[T]) prunePlanArgs(resources []StateResource) []string {
+	args := slices.Clone(terraCallPlan)
+	seen := map[string]bool{}
+	for _, res := range resources {
+		addr := res.ResourceAddress()
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		args = append(args, "-target="+addr)
+	}
+	if a.opts.noRefresh {
+		args = append(args, "-refresh=false")
+	}
+	return append(args, a.commonArgs()...)
+}
+
+// applyArgs returns the arguments for applying the plan with the options of
+// the action.
+// The plan file must be the last argument.
+func (a *TerraAction[T]) applyArgs() []string {
+	planFile := terraCallApply[len(terraCallApply)-1]
+	args := slices.Clone(terraCallApply[:len(terraCallApply)-1])
+	args = append(args, a.commonArgs()...)
+	return append(args, planFile)
+}
+
+// commonArgs returns the arguments shared by plan and apply.
+func (a *TerraAction[T]) commonArgs() []string {
+	var args []string
+	if a.opts.parallelism > 0 {
+		args = append(args, "-parallelism="+strconv.Itoa(a.opts.parallelism))
+	}
+	if a.opts.lockTimeout > 0 {
+		args = append(args, "-lock-timeout="+a.opts.lockTimeout.String())
+	}
+	return args
+}
@@ -0,0 +1,125 @@
+package sylt
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/golingon/lingon/pkg/terra"
+)
+
+// ErrStateKeyCollision is returned when two actions of a [Workflow] would share
+// the same state, because their backends store it in the same location, e.g.
+// their names map to the same state key (see [StateKey]) in the same bucket.
+var ErrStateKeyCollision = errors.New("state key collision")
+
+// WithTerraBackend sets the backend of the stack when it is exported,
+// overriding any backend defined in the stack itself.
+// The function receives the state key of the action, see [StateKey], so that
+// each action gets its own state.
+// With [WithTerraEnvironment], the key is prefixed with the environment name,
+// e.g. "prod/network".
+// For example:
+//
+//	WithTerraBackend(func(key string) terra.Backend {
+//		return &terra.BackendS3{
+//			Bucket: "my-state-bucket",
+//			Key:    key + "/terraform.tfstate",
+//			Region: "eu-north-1",
+//		}
+//	})
+func WithTerraBackend(fn func(key string) terra.Backend) TerraOption {
+	return func(o *terraOpts) {
+		o.backend = fn
+	}
+}
+
+// StateKey derives a state key from an action name, which is safe to use in
+// object storage paths and file names.
+// The name is lower cased and any characters other than letters, digits, '.',
+// '_', '-' and '/' are replaced with '-', e.g. "My Network" becomes
+// "my-network".
+// Different names can map to the same key, e.g. "App A" and "app-a", so a
+// [Workflow] rejects actions whose state keys collide in the same backend
+// location with [ErrStateKeyCollision].
+func StateKey(name string) string {
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z',
+			r >= '0' && r <= '9',
+			r == '.', r == '_', r == '-', r == '/':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, name)
+	return strings.Trim(key, "/")
+}
+
+// stateLocator is implemented by actions which store their state in a
+// backend, so that a [Workflow] can reject collisions.
+type stateLocator interface {
+	// stateLocation returns the location of the state in the backend, and
+	// false if the action has no backend.
+	stateLocation() (string, bool)
+}
+
+func (a *TerraAction[T]) stateLocation() (string, bool) {
+	backend := a.backend(envStateKey(a.ActionEnvironment(), a.Name))
+	if backend == nil {
+		return "", false
+	}
+	return backendLocation(a.dir(), backend), true
+}
+
+// backend returns the backend of the action for the state key, or nil if the
+// backend is not set with [WithTerraBackend] or the environment.
+func (a *TerraAction[T]) backend(key string) terra.Backend {
+	backend := a.opts.backend
+	if backend == nil && a.opts.environment != nil {
+		backend = a.opts.environment.Backend
+	}
+	if backend == nil {
+		return nil
+	}
+	return backend(key)
+}
+
+// backendLocation returns where the backend stores the state, e.g.
+// "s3://bucket/key", so that two backends storing the same state can be
+// detected.
+// Relative local paths are relative to the directory dir of the stack.
+func backendLocation(dir string, backend terra.Backend) string {
+	switch b := backend.(type) {
+	case *terra.BackendS3:
+		return "s3://" + b.Bucket + "/" + b.Key
+	case *terra.BackendGCS:
+		return "gcs://" + b.Bucket + "/" + deref(b.Prefix)
+	case *terra.BackendAzureRM:
+		return fmt.Sprintf(
+			"azurerm://%s/%s/%s",
+			b.StorageAccountName, b.ContainerName, b.Key,
+		)
+	case *terra.BackendHTTP:
+		return b.Address
+	case *terra.BackendLocal:
+		path := b.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		return "local://" + filepath.Clean(path)
+	case *terra.BackendPG:
+		return "pg://" + b.ConnStr + "/" + deref(b.SchemaName)
+	}
+	// The whole configuration of other backends identifies the state.
+	return fmt.Sprintf("%s:%+v", backend.BackendType(), backend)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -1,11 +1,14 @@
 package sylt
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sync"
 )
 
 var (
@@ -21,6 +24,12 @@ var (
 		"-out=" + terraPlanFile,
 		"-destroy",
 	}
+	terraCallPlanRefreshOnly = []string{
+		"plan",
+		"-detailed-exitcode", // Return exit code 2 if there are changes.
+		"-out=" + terraPlanFile,
+		"-refresh-only",
+	}
 	terraCallApply = []string{
 		"apply",
 		"-input=false",
@@ -30,43 +39,124 @@ var (
 	terraCallShowState = []string{"show", "-json"}
 )
 
-// terraCmder is an interface for running Terraform commands.
-// It is an interface for testing purposes.
-// Maybe in the future we want to have specific methods here, like Init(),
-// Plan(), Apply(), etc.
-// And maybe then we export it so people can provide their own.
-// Keep it private for now.
-type terraCmder interface {
-	Run(
-		ctx context.Context,
-		dir string,
-		stdout io.Writer,
-		stderr io.Writer,
-		args ...string,
-	) error
+// TerraCmd describes a single invocation of a terra command, e.g.
+// `tofu plan`.
+type TerraCmd struct {
+	// Dir is the working directory to run the command in.
+	Dir string
+	// Env contains extra environment variables, in the form "KEY=value".
+	Env []string
+	// Args are the arguments to the terra binary, e.g. ["plan", "-out=tfplan"].
+	Args []string
+	// Stdout receives the standard output of the command.
+	Stdout io.Writer
+	// Stderr receives the standard error of the command.
+	Stderr io.Writer
+}
+
+// TerraCmder runs terra commands for a [TerraAction].
+// The default implementation is [ExecTerraCmder] which runs a binary found on
+// the PATH.
+// Custom implementations can be provided using [WithTerraCmder], e.g. to run
+// terra in a container or to replay recorded outputs in tests.
+//
+// If the command exits with a non-zero exit code, the returned error should
+// implement `ExitCode() int` (like [exec.ExitError] and [TerraExitError]) so
+// that detailed exit codes (e.g. from plan) can be handled.
+type TerraCmder interface {
+	Run(ctx context.Context, cmd TerraCmd) error
+}
+
+var _ error = (*TerraExitError)(nil)
+
+// TerraExitError is an error with the exit code of a terra command.
+// It is useful for implementations of [TerraCmder] which do not use
+// [os/exec].
+type TerraExitError struct {
+	Code int
 }
 
-var _ terraCmder = (*terraCmd)(nil)
+func (e *TerraExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
 
-type terraCmd struct {
-	cmd string
+// ExitCode returns the exit code of the command.
+func (e *TerraExitError) ExitCode() int {
+	return e.Code
 }
 
-func (e *terraCmd) Run(
-	ctx context.Context,
-	dir string,
-	stdout io.Writer,
-	stderr io.Writer,
-	args ...string,
-) error {
-	if e.cmd == "" {
+// exitCode returns the exit code from the error, if it has one.
+func exitCode(err error) (int, bool) {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
+var _ TerraCmder = (*ExecTerraCmder)(nil)
+
+// ExecTerraCmder runs terra commands by executing a binary, e.g. `tofu` or
+// `terraform`.
+// The environment variables of the current process are inherited.
+type ExecTerraCmder struct {
+	// Bin is the name or path of the terra binary.
+	Bin string
+}
+
+func (e *ExecTerraCmder) Run(ctx context.Context, tc TerraCmd) error {
+	if e.Bin == "" {
 		return errors.New("no command set")
 	}
-	cmd := exec.CommandContext(ctx, e.cmd, args...)
-	cmd.Dir = dir
+	cmd := exec.CommandContext(ctx, e.Bin, tc.Args...)
+	cmd.Dir = tc.Dir
 	// Inherit environment variables.
-	cmd.Env = os.Environ()
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+	cmd.Env = append(os.Environ(), tc.Env...)
+	cmd.Stdout = tc.Stdout
+	cmd.Stderr = tc.Stderr
 	return cmd.Run()
 }
+
+var _ io.Writer = (*prefixWriter)(nil)
+
+// prefixWriter writes the prefix at the start of each line, so that the
+// output of multiple actions can be told apart.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+
+	mu      sync.Mutex
+	midLine bool
+}
+
+func newPrefixWriter(w io.Writer, prefix string) io.Writer {
+	if prefix == "" {
+		return w
+	}
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(b)
+	var buf bytes.Buffer
+	for len(b) > 0 {
+		if !p.midLine {
+			buf.Write(p.prefix)
+			p.midLine = true
+		}
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			buf.Write(b)
+			break
+		}
+		buf.Write(b[:i+1])
+		b = b[i+1:]
+		p.midLine = false
+	}
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,171 @@
+package sylt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// WithTerraLockRetry retries terra commands which fail because the state is
+// locked, e.g. by another run using the same remote state.
+// The command runs at most attempts times in total, i.e. attempts-1 retries,
+// waiting backoff before the first retry and doubling it for each subsequent
+// retry. An attempts of one or less does not retry.
+//
+// Unlike [WithTerraLockTimeout], which makes terra itself wait for the lock,
+// this retries the whole command and surfaces a [StateLockError] once the
+// attempts are exhausted.
+func WithTerraLockRetry(attempts int, backoff time.Duration) TerraOption {
+	return func(o *terraOpts) {
+		o.lockAttempts = attempts
+		o.lockBackoff = backoff
+	}
+}
+
+var _ error = (*StateLockError)(nil)
+
+// StateLockError is returned when a terra command fails because the state is
+// locked.
+// The lock ID can be used with [TerraAction.ForceUnlock] if the lock is stale,
+// e.g. because a previous run was killed.
+type StateLockError struct {
+	// ID is the ID of the lock.
+	ID string
+	// Path is the path of the locked state.
+	Path string
+	// Operation is the operation holding the lock, e.g. "OperationTypeApply".
+	Operation string
+	// Who is the user and host holding the lock.
+	Who string
+	// Created is when the lock was created, as reported by terra.
+	Created string
+
+	err error
+}
+
+func (e *StateLockError) Error() string {
+	msg := fmt.Sprintf("state is locked (lock ID %q", e.ID)
+	if e.Who != "" {
+		msg += fmt.Sprintf(", held by %s", e.Who)
+	}
+	if e.Created != "" {
+		msg += fmt.Sprintf(" since %s", e.Created)
+	}
+	return msg + ")"
+}
+
+func (e *StateLockError) Unwrap() error {
+	return e.err
+}
+
+// ForceUnlock removes the state lock with the given ID, by running
+// `force-unlock -force <id>`.
+// Only use this when sure that the lock is stale, as removing the lock of a
+// running operation may corrupt the state.
+func (a *TerraAction[T]) ForceUnlock(ctx context.Context, lockID string) error {
+	if lockID == "" {
+		return errors.New("force unlock: lock ID is empty")
+	}
+	a.log.Warn("force unlocking state", "lock_id", lockID)
+	if err := a.runCmd(
+		ctx,
+		a.stdout,
+		a.stderr,
+		"force-unlock", "-force", lockID,
+	); err != nil {
+		return fmt.Errorf("force unlock: %w", err)
+	}
+	return nil
+}
+
+// runWithLockRetry runs the terra command, retrying if the state is locked
+// according to the lock retry options.
+func (a *TerraAction[T]) runWithLockRetry(
+	ctx context.Context,
+	stdout io.Writer,
+	stderr io.Writer,
+	args ...string,
+) error {
+	backoff := a.opts.lockBackoff
+	for attempt := 1; ; attempt++ {
+		err := a.runCmd(ctx, stdout, stderr, args...)
+		var lockErr *StateLockError
+		if !errors.As(err, &lockErr) || attempt >= a.opts.lockAttempts {
+			return err
+		}
+		a.log.Warn(
+			"state is locked, retrying",
+			"lock_id", lockErr.ID,
+			"attempt", attempt,
+			"backoff", backoff,
+		)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// runCmd runs the terra command once, returning a [StateLockError] if it
+// failed because the state is locked.
+func (a *TerraAction[T]) runCmd(
+	ctx context.Context,
+	stdout io.Writer,
+	stderr io.Writer,
+	args ...string,
+) error {
+	var errBuf bytes.Buffer
+	err := a.cmd.Run(ctx, TerraCmd{
+		Dir:    a.dir(),
+		Env:    a.opts.env,
+		Args:   args,
+		Stdout: stdout,
+		Stderr: io.MultiWriter(stderr, &errBuf),
+	})
+	if err == nil {
+		return nil
+	}
+	if lockErr := parseStateLockError(errBuf.Bytes()); lockErr != nil {
+		lockErr.err = err
+		return lockErr
+	}
+	return err
+}
+
+var (
+	stateLockMsg   = []byte("Error acquiring the state lock")
+	stateLockField = regexp.MustCompile(
+		`(?m)^[\s│|]*(ID|Path|Operation|Who|Created):\s+(.*?)\s*$`,
+	)
+)
+
+// parseStateLockError parses the lock info from the stderr output of terra.
+// It returns nil if the output does not contain a state lock error.
+func parseStateLockError(stderr []byte) *StateLockError {
+	if !bytes.Contains(stderr, stateLockMsg) {
+		return nil
+	}
+	var lockErr StateLockError
+	for _, m := range stateLockField.FindAllSubmatch(stderr, -1) {
+		value := string(m[2])
+		switch string(m[1]) {
+		case "ID":
+			lockErr.ID = value
+		case "Path":
+			lockErr.Path = value
+		case "Operation":
+			lockErr.Operation = value
+		case "Who":
+			lockErr.Who = value
+		case "Created":
+			lockErr.Created = value
+		}
+	}
+	return &lockErr
+}
@@ -0,0 +1,175 @@
+package sylt_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"github.com/golingon/lingon/pkg/x/sylt/sylttest"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+const stateLockStderr = `
+╷
+│ Error: Error acquiring the state lock
+│ 
+│ Error message: ConditionalCheckFailedException: The conditional request
+│ failed
+│ Lock Info:
+│   ID:        0b5f5a3c-6c5e-2f4e-8d4a-1d2c3b4a5f6e
+│   Path:      my-state-bucket/network/terraform.tfstate
+│   Operation: OperationTypeApply
+│   Who:       runner@ci
+│   Version:   1.8.0
+│   Created:   2024-05-02 10:15:04.123 +0000 UTC
+│   Info:      
+╵
+`
+
+func TestTerraLockRetry(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	locked := sylttest.Response{Stderr: []byte(stateLockStderr), ExitCode: 1}
+	newFake := func(t *testing.T) *sylttest.Fake {
+		fake := sylttest.NewFake().Script(sylttest.KeyPlan, locked, locked)
+		tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, false, tfjson.Plan{FormatVersion: "1.2"}))
+		tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+		return fake
+	}
+	newAction := func(fake *sylttest.Fake, opts ...sylt.TerraOption) *sylt.TerraAction[*stack] {
+		return sylt.Terra("network", &stack{}, append([]sylt.TerraOption{
+			sylt.WithTerraCmder(fake),
+			sylt.WithTerraDir(t.TempDir()),
+			sylt.WithTerraOutput(io.Discard, io.Discard),
+		}, opts...)...)
+	}
+	ctx := context.Background()
+
+	t.Run("retry", func(t *testing.T) {
+		fake := newFake(t)
+		act := newAction(fake, sylt.WithTerraLockRetry(3, time.Millisecond))
+		tu.AssertNoError(t, act.Run(ctx, sylt.RunOpts{DryRun: true}))
+		tu.AssertEqualSlice(t, []string{
+			sylttest.KeyInit,
+			sylttest.KeyPlan,
+			sylttest.KeyPlan,
+			sylttest.KeyPlan,
+			sylttest.KeyShowPlan,
+			sylttest.KeyShowState,
+		}, fake.Keys())
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		fake := newFake(t)
+		act := newAction(fake, sylt.WithTerraLockRetry(2, time.Millisecond))
+		err := act.Run(ctx, sylt.RunOpts{DryRun: true})
+		var lockErr *sylt.StateLockError
+		if !errors.As(err, &lockErr) {
+			t.Fatalf("expected state lock error, got: %v", err)
+		}
+		tu.AssertEqual(t, sylt.StateLockError{
+			ID:        "0b5f5a3c-6c5e-2f4e-8d4a-1d2c3b4a5f6e",
+			Path:      "my-state-bucket/network/terraform.tfstate",
+			Operation: "OperationTypeApply",
+			Who:       "runner@ci",
+			Created:   "2024-05-02 10:15:04.123 +0000 UTC",
+		}, sylt.StateLockError{
+			ID:        lockErr.ID,
+			Path:      lockErr.Path,
+			Operation: lockErr.Operation,
+			Who:       lockErr.Who,
+			Created:   lockErr.Created,
+		})
+		// Init, then the two attempts of the plan.
+		tu.AssertEqualSlice(t, []string{
+			sylttest.KeyInit,
+			sylttest.KeyPlan,
+			sylttest.KeyPlan,
+		}, fake.Keys())
+
+		tu.AssertNoError(t, act.ForceUnlock(ctx, lockErr.ID))
+		calls := fake.Calls()
+		tu.AssertEqualSlice(
+			t,
+			[]string{"force-unlock", "-force", lockErr.ID},
+			calls[len(calls)-1].Args,
+		)
+	})
+}
+
+func TestStateKey(t *testing.T) {
+	tests := map[string]string{
+		"network":          "network",
+		"My Network":       "my-network",
+		"eu/prod:cluster":  "eu/prod-cluster",
+		"/leading-slash/":  "leading-slash",
+		"app_v1.2-service": "app_v1.2-service",
+	}
+	for name, exp := range tests {
+		tu.AssertEqual(t, exp, sylt.StateKey(name))
+	}
+}
+
+func TestTerraBackend(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	dir := t.TempDir()
+	act := sylt.Terra(
+		"My Network",
+		&stack{},
+		sylt.WithTerraDir(dir),
+		sylt.WithTerraBackend(func(key string) terra.Backend {
+			return &terra.BackendLocal{Path: key + ".tfstate"}
+		}),
+	)
+	tu.AssertNoError(t, act.Export())
+	b, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+	tu.AssertNoError(t, err)
+	tu.AssertEqual(t, `terraform {
+  backend "local" {
+    path = "my-network.tfstate"
+  }
+}
+
+`, string(b))
+
+	t.Run("collision", func(t *testing.T) {
+		shared := t.TempDir()
+		newAction := func(name, stateDir string) sylt.Actioner {
+			fake := sylttest.NewFake()
+			tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, false, tfjson.Plan{
+				FormatVersion: "1.2",
+			}))
+			tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+			return sylt.Terra(
+				name,
+				&stack{},
+				sylt.WithTerraCmder(fake),
+				sylt.WithTerraDir(t.TempDir()),
+				sylt.WithTerraOutput(io.Discard, io.Discard),
+				sylt.WithTerraBackend(func(key string) terra.Backend {
+					return &terra.BackendLocal{
+						Path: filepath.Join(stateDir, key+".tfstate"),
+					}
+				}),
+			)
+		}
+		wf := sylt.NewWorkflow()
+		ctx := context.Background()
+		tu.AssertNoError(t, wf.Run(ctx, newAction("App A", shared)))
+		err := wf.Run(ctx, newAction("app-a", shared))
+		tu.ErrorIs(t, err, sylt.ErrStateKeyCollision)
+		tu.AssertNoError(t, wf.Run(ctx, newAction("app-b", shared)))
+		// The same key in another backend location is a different state.
+		tu.AssertNoError(t, wf.Run(ctx, newAction("app-a", t.TempDir())))
+	})
+}
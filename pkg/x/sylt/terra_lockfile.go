@@ -0,0 +1,253 @@
+package sylt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// terraLockFile is the name of the dependency lock file created by terra init.
+const terraLockFile = ".terraform.lock.hcl"
+
+// terraCallInitLocked initialises using the provider versions from the lock
+// file, as opposed to [terraCallInit] which upgrades them.
+var terraCallInitLocked = []string{"init"}
+
+// WithTerraLockFile persists the dependency lock file of the action at the
+// given path, e.g. next to the code defining the stack, so that it can be
+// committed.
+//
+// Before init the lock file is copied into the working directory of the
+// action, and after init it is copied back to the given path.
+// When a lock file exists, init runs without `-upgrade` so that the locked
+// provider versions are used.
+// Use [TerraAction.UpgradeLock] to upgrade the providers.
+func WithTerraLockFile(path string) TerraOption {
+	return func(o *terraOpts) {
+		o.lockFile = path
+	}
+}
+
+// LockUpgrader is implemented by actions which can upgrade their dependency
+// lock file, e.g. [TerraAction].
+type LockUpgrader interface {
+	UpgradeLock(ctx context.Context) ([]ProviderLockChange, error)
+}
+
+// ProviderLockChange describes how a provider changed in the dependency lock
+// file.
+type ProviderLockChange struct {
+	// Source is the source address of the provider,
+	// e.g. "registry.opentofu.org/hashicorp/aws".
+	Source string `json:"source"`
+	// OldVersion is the previously locked version, empty if the provider was
+	// added.
+	OldVersion string `json:"old_version,omitempty"`
+	// NewVersion is the locked version, empty if the provider was removed.
+	NewVersion string `json:"new_version,omitempty"`
+	// AddedHashes are the hashes which were added to the lock file.
+	AddedHashes []string `json:"added_hashes,omitempty"`
+	// RemovedHashes are the hashes which were removed from the lock file.
+	RemovedHashes []string `json:"removed_hashes,omitempty"`
+}
+
+// String returns a short description of the change,
+// e.g. "registry.opentofu.org/hashicorp/aws: 5.0.0 -> 5.1.0 (+4 -4 hashes)".
+func (c ProviderLockChange) String() string {
+	var version string
+	switch {
+	case c.OldVersion == "":
+		version = "added " + c.NewVersion
+	case c.NewVersion == "":
+		version = "removed " + c.OldVersion
+	case c.OldVersion == c.NewVersion:
+		version = c.NewVersion
+	default:
+		version = c.OldVersion + " -> " + c.NewVersion
+	}
+	return fmt.Sprintf(
+		"%s: %s (+%d -%d hashes)",
+		c.Source,
+		version,
+		len(c.AddedHashes),
+		len(c.RemovedHashes),
+	)
+}
+
+// UpgradeLock runs init with `-upgrade`, upgrading the providers to the newest
+// versions allowed by their constraints, and returns the providers which
+// changed in the dependency lock file.
+// The stack must have been exported before, e.g. with [TerraAction.Export].
+func (a *TerraAction[T]) UpgradeLock(
+	ctx context.Context,
+) ([]ProviderLockChange, error) {
+	if err := a.restoreLockFile(); err != nil {
+		return nil, fmt.Errorf("upgrading lock file: %w", err)
+	}
+	before, err := readLockFile(a.dirLockFile())
+	if err != nil {
+		return nil, fmt.Errorf("upgrading lock file: %w", err)
+	}
+	if err := a.init(ctx, terraCallInit); err != nil {
+		return nil, fmt.Errorf("upgrading lock file: %w", err)
+	}
+	after, err := readLockFile(a.dirLockFile())
+	if err != nil {
+		return nil, fmt.Errorf("upgrading lock file: %w", err)
+	}
+	changes := diffLockFiles(before, after)
+	for _, c := range changes {
+		a.log.Info("provider lock changed", "change", c.String())
+	}
+	return changes, nil
+}
+
+// initArgs returns the arguments for init, which only upgrades the providers
+// when there is no lock file.
+func (a *TerraAction[T]) initArgs() ([]string, error) {
+	_, err := os.Stat(a.dirLockFile())
+	switch {
+	case err == nil:
+		return terraCallInitLocked, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return terraCallInit, nil
+	}
+	return nil, fmt.Errorf("checking lock file: %w", err)
+}
+
+func (a *TerraAction[T]) dirLockFile() string {
+	return filepath.Join(a.dir(), terraLockFile)
+}
+
+// restoreLockFile copies the persisted lock file into the working directory,
+// if it exists.
+func (a *TerraAction[T]) restoreLockFile() error {
+	if a.opts.lockFile == "" {
+		return nil
+	}
+	err := copyFile(a.opts.lockFile, a.dirLockFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("restoring lock file: %w", err)
+	}
+	return nil
+}
+
+// persistLockFile copies the lock file from the working directory to the
+// persisted lock file, if it exists.
+func (a *TerraAction[T]) persistLockFile() error {
+	if a.opts.lockFile == "" {
+		return nil
+	}
+	err := copyFile(a.dirLockFile(), a.opts.lockFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("persisting lock file: %w", err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, 0o644)
+}
+
+type lockFile struct {
+	Providers []lockProvider `hcl:"provider,block"`
+}
+
+type lockProvider struct {
+	Source      string   `hcl:"source,label"`
+	Version     string   `hcl:"version"`
+	Constraints string   `hcl:"constraints,optional"`
+	Hashes      []string `hcl:"hashes,optional"`
+	Remain      hcl.Body `hcl:",remain"`
+}
+
+// readLockFile reads the providers from the lock file, which is empty if the
+// lock file does not exist.
+func readLockFile(path string) (map[string]lockProvider, error) {
+	providers := map[string]lockProvider{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return providers, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading lock file: %w", err)
+	}
+	f, diags := hclparse.NewParser().ParseHCL(b, path)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parsing lock file: %w", diags)
+	}
+	var lf lockFile
+	if diags := gohcl.DecodeBody(f.Body, nil, &lf); diags.HasErrors() {
+		return nil, fmt.Errorf("decoding lock file: %w", diags)
+	}
+	for _, p := range lf.Providers {
+		providers[p.Source] = p
+	}
+	return providers, nil
+}
+
+// diffLockFiles returns the providers which changed between the lock files,
+// sorted by source.
+func diffLockFiles(before, after map[string]lockProvider) []ProviderLockChange {
+	sources := make([]string, 0, len(before)+len(after))
+	for s := range before {
+		sources = append(sources, s)
+	}
+	for s := range after {
+		if _, ok := before[s]; !ok {
+			sources = append(sources, s)
+		}
+	}
+	slices.Sort(sources)
+
+	var changes []ProviderLockChange
+	for _, s := range sources {
+		prev, next := before[s], after[s]
+		c := ProviderLockChange{
+			Source:        s,
+			OldVersion:    prev.Version,
+			NewVersion:    next.Version,
+			AddedHashes:   hashesDiff(next.Hashes, prev.Hashes),
+			RemovedHashes: hashesDiff(prev.Hashes, next.Hashes),
+		}
+		if c.OldVersion == c.NewVersion &&
+			len(c.AddedHashes) == 0 &&
+			len(c.RemovedHashes) == 0 {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// hashesDiff returns the hashes in a which are not in b.
+func hashesDiff(a, b []string) []string {
+	var diff []string
+	for _, h := range a {
+		if !slices.Contains(b, h) {
+			diff = append(diff, h)
+		}
+	}
+	return diff
+}
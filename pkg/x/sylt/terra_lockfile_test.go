@@ -0,0 +1,140 @@
+package sylt_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"github.com/golingon/lingon/pkg/x/sylt/sylttest"
+)
+
+const (
+	lockFileV1 = `provider "registry.opentofu.org/hashicorp/random" {
+  version     = "3.5.0"
+  constraints = "~> 3.5"
+  hashes = [
+    "h1:aaa",
+    "zh:bbb",
+  ]
+}
+`
+	lockFileV2 = `provider "registry.opentofu.org/hashicorp/random" {
+  version     = "3.6.0"
+  constraints = "~> 3.5"
+  hashes = [
+    "h1:ccc",
+    "zh:bbb",
+  ]
+}
+
+provider "registry.opentofu.org/hashicorp/null" {
+  version = "3.2.0"
+  hashes = [
+    "h1:ddd",
+  ]
+}
+`
+)
+
+// lockFileCmder writes a lock file on init, like terra would.
+type lockFileCmder struct {
+	*sylttest.Fake
+	// upgrade is the lock file written by init with -upgrade.
+	upgrade string
+}
+
+func (c *lockFileCmder) Run(ctx context.Context, cmd sylt.TerraCmd) error {
+	if err := c.Fake.Run(ctx, cmd); err != nil {
+		return err
+	}
+	if cmd.Args[0] != "init" {
+		return nil
+	}
+	path := filepath.Join(cmd.Dir, ".terraform.lock.hcl")
+	if slices.Contains(cmd.Args, "-upgrade") {
+		return os.WriteFile(path, []byte(c.upgrade), 0o644)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	return nil
+}
+
+func TestTerraLockFile(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	ctx := context.Background()
+	lockFile := filepath.Join(t.TempDir(), "network", ".terraform.lock.hcl")
+	newAction := func(cmder sylt.TerraCmder) *sylt.TerraAction[*stack] {
+		return sylt.Terra(
+			"network",
+			&stack{},
+			sylt.WithTerraCmder(cmder),
+			sylt.WithTerraDir(t.TempDir()),
+			sylt.WithTerraOutput(io.Discard, io.Discard),
+			sylt.WithTerraLockFile(lockFile),
+		)
+	}
+	readLockFile := func(t *testing.T) string {
+		b, err := os.ReadFile(lockFile)
+		tu.AssertNoError(t, err)
+		return string(b)
+	}
+
+	// Without a lock file the providers are upgraded and the lock file is
+	// persisted.
+	cmder := &lockFileCmder{Fake: sylttest.NewFake(), upgrade: lockFileV1}
+	tu.AssertNoError(t, newAction(cmder).Init(ctx))
+	tu.AssertEqualSlice(
+		t,
+		[]string{"init", "-upgrade"},
+		cmder.Calls()[0].Args,
+	)
+	tu.AssertEqual(t, lockFileV1, readLockFile(t))
+
+	// With a lock file, in a fresh working directory, the locked versions are
+	// used.
+	cmder = &lockFileCmder{Fake: sylttest.NewFake(), upgrade: lockFileV2}
+	act := newAction(cmder)
+	tu.AssertNoError(t, act.Init(ctx))
+	tu.AssertEqualSlice(t, []string{"init"}, cmder.Calls()[0].Args)
+	tu.AssertEqual(t, lockFileV1, readLockFile(t))
+
+	// Upgrading reports the changed providers.
+	changes, err := act.UpgradeLock(ctx)
+	tu.AssertNoError(t, err)
+	tu.AssertEqualSlice(
+		t,
+		[]string{"init", "-upgrade"},
+		cmder.Calls()[1].Args,
+	)
+	if diff := tu.Diff(changes, []sylt.ProviderLockChange{
+		{
+			Source:      "registry.opentofu.org/hashicorp/null",
+			NewVersion:  "3.2.0",
+			AddedHashes: []string{"h1:ddd"},
+		},
+		{
+			Source:        "registry.opentofu.org/hashicorp/random",
+			OldVersion:    "3.5.0",
+			NewVersion:    "3.6.0",
+			AddedHashes:   []string{"h1:ccc"},
+			RemovedHashes: []string{"h1:aaa"},
+		},
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	tu.AssertEqual(
+		t,
+		"registry.opentofu.org/hashicorp/random: 3.5.0 -> 3.6.0 (+1 -1 hashes)",
+		changes[1].String(),
+	)
+	tu.AssertEqual(t, lockFileV2, readLockFile(t))
+}
@@ -18,14 +18,56 @@ func (p *plan) diff() bool {
 	if p.isApplied {
 		return false
 	}
+	return len(changedAddresses(p.out.ResourceChanges)) > 0
+}
+
+// summary counts the resources to add, change and destroy in the plan.
+// A replaced resource counts as both added and destroyed.
+func (p *plan) summary() PlanSummary {
+	var s PlanSummary
 	for _, res := range p.out.ResourceChanges {
-		for _, action := range res.Change.Actions {
-			switch action {
-			case tfjson.ActionCreate, tfjson.ActionDelete, tfjson.ActionUpdate:
-				return true
-			default:
-				continue
-			}
+		if res.Change == nil {
+			continue
+		}
+		actions := res.Change.Actions
+		switch {
+		case actions.Replace():
+			s.Add++
+			s.Destroy++
+		case actions.Create():
+			s.Add++
+		case actions.Update():
+			s.Change++
+		case actions.Delete():
+			s.Destroy++
+		}
+	}
+	return s
+}
+
+// changedAddresses returns the addresses of the resources that have a create,
+// update or delete action.
+// No-op and read actions are ignored.
+func changedAddresses(changes []*tfjson.ResourceChange) []string {
+	var addrs []string
+	for _, res := range changes {
+		if res.Change == nil {
+			continue
+		}
+		if isChange(res.Change.Actions) {
+			addrs = append(addrs, res.Address)
+		}
+	}
+	return addrs
+}
+
+func isChange(actions tfjson.Actions) bool {
+	for _, action := range actions {
+		switch action {
+		case tfjson.ActionCreate, tfjson.ActionDelete, tfjson.ActionUpdate:
+			return true
+		default:
+			continue
 		}
 	}
 	return false
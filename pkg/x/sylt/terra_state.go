@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/golingon/lingon/pkg/terra"
@@ -22,7 +24,7 @@ type MissingStateError struct {
 func (se *MissingStateError) Error() string {
 	strRes := make([]string, len(se.Resources))
 	for i, res := range se.Resources {
-		strRes[i] = fmt.Sprintf("%s.%s", res.Type(), res.LocalName())
+		strRes[i] = resourceAddress(res)
 	}
 	return fmt.Sprintf(
 		"missing state for resources: [%s]",
@@ -30,6 +32,12 @@ func (se *MissingStateError) Error() string {
 	)
 }
 
+// resourceAddress returns the address of the resource in the root module, e.g.
+// aws_iam_role.example.
+func resourceAddress(res terra.Resource) string {
+	return res.Type() + "." + res.LocalName()
+}
+
 type ResourceStater[T any] interface {
 	terra.Resource
 	State() (T, bool)
@@ -83,16 +91,187 @@ const (
 	StateStatusOverflow StateStatus = 4
 )
 
+var stateStatusNames = map[StateStatus]string{
+	StateStatusUnknown:  "unknown",
+	StateStatusEmpty:    "empty",
+	StateStatusPartial:  "partial",
+	StateStatusSync:     "sync",
+	StateStatusOverflow: "overflow",
+}
+
+func (s StateStatus) String() string {
+	if name, ok := stateStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("StateStatus(%d)", int(s))
+}
+
+// MarshalText implements [encoding.TextMarshaler].
+func (s StateStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler].
+func (s *StateStatus) UnmarshalText(text []byte) error {
+	for status, name := range stateStatusNames {
+		if name == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown state status: %q", string(text))
+}
+
+// StateAddresser can be implemented by resources to match a specific
+// instance in the state, such as a resource in a child module or an instance
+// created with count or for_each (e.g. aws_subnet.private[0]).
+// This is useful when reading state that is managed elsewhere, e.g. by HCL
+// modules.
+// By default, resources match the instance in the root module with the same
+// type and local name, and no instance key, or else the first instance in the
+// root module with the same type and local name, whatever its key.
+//
+// Use [InstanceAddress] to create the address.
+// Resources which cannot implement it, e.g. generated provider resources, can
+// be addressed with [WithTerraStateAddress].
+type StateAddresser interface {
+	StateAddress() string
+}
+
+// StateAddressFunc returns the state address of the resource, like
+// [StateAddresser], or an empty string for the default address.
+type StateAddressFunc func(res terra.Resource) string
+
+// WithTerraStateAddress sets the state address of the resources of the stack,
+// e.g. to match a resource in a child module or an instance created with
+// count or for_each, like [StateAddresser].
+// It takes precedence over [StateAddresser] for the resources it returns an
+// address for.
+func WithTerraStateAddress(fn StateAddressFunc) TerraOption {
+	return func(o *terraOpts) {
+		o.stateAddress = fn
+	}
+}
+
+// InstanceAddress returns the state address of the resource instance in the
+// given module, with the given instance key.
+// The module is the module address (e.g. module.vpc), or empty for the root
+// module.
+// The key is an int for count, a string for for_each or nil for neither.
+//
+//	InstanceAddress("module.vpc", subnet, 0)   // module.vpc.aws_subnet.private[0]
+//	InstanceAddress("", subnet, "a")           // aws_subnet.private["a"]
+func InstanceAddress(module string, res terra.Resource, key any) string {
+	return instanceAddress(module, res.Type(), res.LocalName(), key)
+}
+
+func instanceAddress(module string, typ string, name string, key any) string {
+	var b strings.Builder
+	if module != "" {
+		b.WriteString(module)
+		b.WriteString(".")
+	}
+	b.WriteString(typ)
+	b.WriteString(".")
+	b.WriteString(name)
+	switch k := key.(type) {
+	case nil:
+	case string:
+		b.WriteString("[" + strconv.Quote(k) + "]")
+	default:
+		fmt.Fprintf(&b, "[%v]", k)
+	}
+	return b.String()
+}
+
+// stateAddress returns the address of the state instance for the resource,
+// and false if it is the default address (see [StateAddresser]).
+func stateAddress(res terra.Resource, fn StateAddressFunc) (string, bool) {
+	if fn != nil {
+		if addr := fn(res); addr != "" {
+			return addr, true
+		}
+	}
+	if sa, ok := res.(StateAddresser); ok {
+		return sa.StateAddress(), true
+	}
+	return resourceAddress(res), false
+}
+
+// StateReport describes how the state matches the stack.
+type StateReport struct {
+	// Status indicates how complete the state of the stack is.
+	Status StateStatus
+	// Missing contains the resources in the stack which have no state.
+	Missing []MissingResource
+	// Overflow contains the resources in the state which are not in the stack.
+	Overflow []StateResource
+}
+
+// MissingResource is a resource in a stack which has no state.
+type MissingResource struct {
+	// Address is the state address the resource was expected at.
+	Address string
+	// Candidates are instances in the state with the same type and name as
+	// the resource, but in a different module or with a different instance
+	// key.
+	// They are the likely cause of the mismatch.
+	Candidates []StateResource
+}
+
+func (m MissingResource) String() string {
+	if len(m.Candidates) == 0 {
+		return m.Address
+	}
+	addrs := make([]string, len(m.Candidates))
+	for i, c := range m.Candidates {
+		addrs[i] = c.Address
+	}
+	return fmt.Sprintf(
+		"%s (found in state: %s)", m.Address, strings.Join(addrs, ","),
+	)
+}
+
 // StackImportState imports the Terraform state into the Terraform Stack.
 // A [StateStatus] is returned indicating how complete the state of the
 // resources is.
+//
+// See [StackImportStateReport] for more details on mismatches.
 func StackImportState(
 	stack terra.Exporter,
 	state *tfjson.State,
 ) (StateStatus, error) {
+	report, err := StackImportStateReport(stack, state)
+	if err != nil {
+		return StateStatusUnknown, err
+	}
+	return report.Status, nil
+}
+
+// StackImportStateReport imports the Terraform state into the Terraform Stack,
+// and reports how the state matches the stack.
+//
+// All modules in the state are searched.
+// A resource matches the state instance with the same address: by default a
+// resource in the root module, without an instance key, or else with any
+// instance key (see [StateAddresser]).
+func StackImportStateReport(
+	stack terra.Exporter,
+	state *tfjson.State,
+) (*StateReport, error) {
+	return importStateReport(stack, state, nil)
+}
+
+// importStateReport imports the state into the stack like
+// [StackImportStateReport], with the given state addresses.
+func importStateReport(
+	stack terra.Exporter,
+	state *tfjson.State,
+	addr StateAddressFunc,
+) (*StateReport, error) {
 	sb, err := terra.ObjectsFromStack(stack)
 	if err != nil {
-		return StateStatusUnknown, fmt.Errorf("getting stack objects: %w", err)
+		return nil, fmt.Errorf("getting stack objects: %w", err)
 	}
 	// Note: ideally we would always set the state to nil for each resource
 	// before importing the current state.
@@ -100,50 +279,228 @@ func StackImportState(
 	// [terra.Resource] interface.
 	// Probably better not to reuse the same stack for multiple runs anyway,
 	// so this is a bit of an edge case.
-	if state.Values == nil || len(state.Values.RootModule.Resources) == 0 {
-		return StateStatusEmpty, nil
-	}
-	isFullState := true
-	stateResources := state.Values.RootModule.Resources
-	// Iterate over the resources in the Stack and try to find the corresponding
-	// resource in the state.
-	// If it exists, import the state into the Stack.
-	for _, res := range sb.Resources {
-		resFound := false
-		for _, sr := range stateResources {
-			// Find the resource in the state. It is the same resource if the
-			// resource type and resource local name match because that is how
-			// Terraform uniquely identifies resources in its state.
-			if res.Type() == sr.Type && res.LocalName() == sr.Name {
-				resFound = true
-				var b bytes.Buffer
-				if err := json.NewEncoder(&b).Encode(sr.AttributeValues); err != nil {
-					return StateStatusUnknown, fmt.Errorf(
-						"encoding attribute values for resource %s.%s: %w",
-						res.Type(), res.LocalName(), err,
-					)
-				}
-				if err := res.ImportState(&b); err != nil {
-					return StateStatusUnknown, fmt.Errorf(
-						"importing state into resource %s.%s: %w",
-						res.Type(), res.LocalName(), err,
-					)
-				}
-				break
+	report, matches := matchState(sb.Resources, managedResources(state), addr)
+	for i, res := range sb.Resources {
+		sr, ok := matches[i]
+		if !ok {
+			continue
+		}
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(sr.AttributeValues); err != nil {
+			return nil, fmt.Errorf(
+				"encoding attribute values for resource %s: %w",
+				sr.Address, err,
+			)
+		}
+		if err := res.ImportState(&b); err != nil {
+			return nil, fmt.Errorf(
+				"importing state into resource %s: %w",
+				sr.Address, err,
+			)
+		}
+	}
+	return report, nil
+}
+
+// StateResource identifies a resource instance in the Terraform state.
+type StateResource struct {
+	// Address is the absolute address of the resource instance, e.g.
+	// module.vpc.aws_subnet.private[0].
+	Address string `json:"address"`
+	// Module is the address of the module containing the resource, e.g.
+	// module.vpc, or empty for the root module.
+	Module string `json:"module,omitempty"`
+	// Type is the resource type, e.g. aws_subnet.
+	Type string `json:"type"`
+	// Name is the local name of the resource, e.g. private.
+	Name string `json:"name"`
+	// Index is the instance key for resources created with count (int) or
+	// for_each (string).
+	Index any `json:"index,omitempty"`
+}
+
+func (r StateResource) String() string {
+	return r.Address
+}
+
+// ResourceAddress returns the address of the resource without the instance
+// key, e.g. module.vpc.aws_subnet.private.
+func (r StateResource) ResourceAddress() string {
+	return instanceAddress(r.Module, r.Type, r.Name, nil)
+}
+
+// StackStateOverflow returns the resources in the state which are not in the
+// stack.
+// These are the resources that cause a [StateStatusOverflow].
+func StackStateOverflow(
+	stack terra.Exporter,
+	state *tfjson.State,
+) ([]StateResource, error) {
+	sb, err := terra.ObjectsFromStack(stack)
+	if err != nil {
+		return nil, fmt.Errorf("getting stack objects: %w", err)
+	}
+	report, _ := matchState(sb.Resources, managedResources(state), nil)
+	return report.Overflow, nil
+}
+
+// stateInstance is a resource instance in the state, with its module.
+type stateInstance struct {
+	*tfjson.StateResource
+	module string
+}
+
+func (si stateInstance) resource() StateResource {
+	sr := StateResource{
+		Address: si.Address,
+		Module:  si.module,
+		Type:    si.Type,
+		Name:    si.Name,
+		Index:   normalizeIndex(si.Index),
+	}
+	if sr.Address == "" {
+		sr.Address = instanceAddress(sr.Module, sr.Type, sr.Name, sr.Index)
+	}
+	return sr
+}
+
+// matchState matches the stack resources with the state instances.
+// It returns the report of the match, and the matching state instance for
+// each resource, by index.
+//
+// Resources with the default address which have no exact match fall back to
+// the first unmatched instance in the root module with the same type and
+// local name, e.g. an instance created with count. The other instances of the
+// resource are then not reported as overflow, as they cannot be pruned
+// without it.
+func matchState(
+	resources []terra.Resource,
+	instances []stateInstance,
+	addrFn StateAddressFunc,
+) (*StateReport, map[int]stateInstance) {
+	byAddress := make(map[string]stateInstance, len(instances))
+	for _, si := range instances {
+		byAddress[si.resource().Address] = si
+	}
+	report := StateReport{}
+	matches := make(map[int]stateInstance, len(resources))
+	matched := make(map[string]bool, len(resources))
+	// Resources matched by their type and name, by address without the
+	// instance key.
+	fallback := map[string]bool{}
+	var unmatched []int
+	addrs := make([]string, len(resources))
+	for i, res := range resources {
+		addr, explicit := stateAddress(res, addrFn)
+		addrs[i] = addr
+		if si, ok := byAddress[addr]; ok {
+			matches[i] = si
+			matched[addr] = true
+			continue
+		}
+		if !explicit {
+			unmatched = append(unmatched, i)
+			continue
+		}
+		report.Missing = append(report.Missing, missingResource(addr, res, instances))
+	}
+	for _, i := range unmatched {
+		res := resources[i]
+		idx := slices.IndexFunc(instances, func(si stateInstance) bool {
+			return si.module == "" &&
+				si.Type == res.Type() &&
+				si.Name == res.LocalName() &&
+				!matched[si.resource().Address]
+		})
+		if idx < 0 {
+			report.Missing = append(
+				report.Missing,
+				missingResource(addrs[i], res, instances),
+			)
+			continue
+		}
+		si := instances[idx]
+		matches[i] = si
+		matched[si.resource().Address] = true
+		fallback[si.resource().ResourceAddress()] = true
+	}
+	for _, si := range instances {
+		sr := si.resource()
+		if matched[sr.Address] || fallback[sr.ResourceAddress()] {
+			continue
+		}
+		report.Overflow = append(report.Overflow, sr)
+	}
+	switch {
+	case len(instances) == 0:
+		report.Status = StateStatusEmpty
+	case len(report.Missing) > 0:
+		report.Status = StateStatusPartial
+	case len(report.Overflow) > 0:
+		// All the stack resources have state, but the state has resources
+		// that are not in the stack.
+		report.Status = StateStatusOverflow
+	default:
+		report.Status = StateStatusSync
+	}
+	return &report, matches
+}
+
+// missingResource returns the missing resource at the address, with the
+// instances of the same type and name as candidates.
+func missingResource(
+	addr string,
+	res terra.Resource,
+	instances []stateInstance,
+) MissingResource {
+	missing := MissingResource{Address: addr}
+	for _, si := range instances {
+		if si.Type == res.Type() && si.Name == res.LocalName() {
+			missing.Candidates = append(missing.Candidates, si.resource())
+		}
+	}
+	return missing
+}
+
+// managedResources returns the managed resource instances in all modules of
+// the state, i.e. ignoring data sources which are not part of the stack's
+// state.
+func managedResources(state *tfjson.State) []stateInstance {
+	if state.Values == nil || state.Values.RootModule == nil {
+		return nil
+	}
+	var instances []stateInstance
+	var walk func(mod *tfjson.StateModule)
+	walk = func(mod *tfjson.StateModule) {
+		for _, sr := range mod.Resources {
+			if sr.Mode == tfjson.DataResourceMode {
+				continue
 			}
+			instances = append(instances, stateInstance{
+				StateResource: sr,
+				module:        mod.Address,
+			})
 		}
-		if !resFound {
-			isFullState = false
+		for _, child := range mod.ChildModules {
+			walk(child)
 		}
 	}
-	if isFullState {
-		// If all the stack resources have state, check that the state does not
-		// have more resources than the stack. If it does, it means that the
-		// state has resources that are not in the stack.
-		if len(stateResources) > len(sb.Resources) {
-			return StateStatusOverflow, nil
+	walk(state.Values.RootModule)
+	return instances
+}
+
+// normalizeIndex converts the instance key from the state JSON into an int or
+// a string.
+func normalizeIndex(index any) any {
+	switch idx := index.(type) {
+	case json.Number:
+		if i, err := idx.Int64(); err == nil {
+			return int(i)
 		}
-		return StateStatusSync, nil
+		return idx.String()
+	case float64:
+		return int(idx)
+	default:
+		return index
 	}
-	return StateStatusPartial, nil
 }
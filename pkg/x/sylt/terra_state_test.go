@@ -1,13 +1,16 @@
 package sylt
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/golingon/lingon/pkg/terra"
 	"github.com/golingon/lingon/pkg/testutil"
+	tfjson "github.com/hashicorp/terraform-json"
 )
 
 var _ ResourceStater[*struct{}] = (*dummyResource)(nil)
@@ -105,3 +108,192 @@ func TestMissingError(t *testing.T) {
 		)
 	})
 }
+
+var _ terra.Resource = (*stateResource)(nil)
+
+// stateResource records the state imported into it.
+type stateResource struct {
+	typ     string
+	name    string
+	address string
+	state   string
+}
+
+func (s *stateResource) Configuration() interface{}       { return nil }
+func (s *stateResource) Dependencies() terra.Dependencies { return nil }
+func (s *stateResource) LifecycleManagement() *terra.Lifecycle {
+	return nil
+}
+func (s *stateResource) LocalName() string { return s.name }
+func (s *stateResource) Type() string      { return s.typ }
+
+func (s *stateResource) ImportState(attributes io.Reader) error {
+	var values struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(attributes).Decode(&values); err != nil {
+		return err
+	}
+	s.state = values.ID
+	return nil
+}
+
+var _ StateAddresser = (*instanceResource)(nil)
+
+type instanceResource struct {
+	*stateResource
+}
+
+func (i *instanceResource) StateAddress() string {
+	return i.address
+}
+
+func TestStackImportStateReport(t *testing.T) {
+	const stateJSON = `{
+  "format_version": "1.0",
+  "values": {
+    "root_module": {
+      "resources": [
+        {"address": "aws_vpc.main", "mode": "managed", "type": "aws_vpc", "name": "main", "values": {"id": "vpc"}},
+        {"address": "aws_subnet.private[0]", "mode": "managed", "type": "aws_subnet", "name": "private", "index": 0, "values": {"id": "subnet-0"}},
+        {"address": "aws_subnet.private[1]", "mode": "managed", "type": "aws_subnet", "name": "private", "index": 1, "values": {"id": "subnet-1"}},
+        {"address": "aws_eip.orphan", "mode": "managed", "type": "aws_eip", "name": "orphan", "values": {"id": "eip"}}
+      ],
+      "child_modules": [
+        {
+          "address": "module.vpc",
+          "resources": [
+            {"address": "module.vpc.aws_subnet.private[\"a\"]", "mode": "managed", "type": "aws_subnet", "name": "private", "index": "a", "values": {"id": "subnet-a"}},
+            {"address": "module.vpc.aws_route.public", "mode": "managed", "type": "aws_route", "name": "public", "values": {"id": "route"}}
+          ]
+        }
+      ]
+    }
+  }
+}`
+	var state tfjson.State
+	dec := json.NewDecoder(strings.NewReader(stateJSON))
+	dec.UseNumber()
+	testutil.AssertNoError(t, dec.Decode(&state))
+
+	type stack struct {
+		terra.Stack
+		VPC     *stateResource
+		Subnet0 *instanceResource
+		SubnetA *instanceResource
+		Subnet  *stateResource
+		Route   *stateResource
+	}
+	subnet := func() *stateResource {
+		return &stateResource{typ: "aws_subnet", name: "private"}
+	}
+	st := stack{
+		VPC:    &stateResource{typ: "aws_vpc", name: "main"},
+		Subnet: subnet(),
+		Route:  &stateResource{typ: "aws_route", name: "public"},
+	}
+	st.Subnet0 = &instanceResource{stateResource: subnet()}
+	st.Subnet0.address = InstanceAddress("", st.Subnet0, 0)
+	st.SubnetA = &instanceResource{stateResource: subnet()}
+	st.SubnetA.address = InstanceAddress("module.vpc", st.SubnetA, "a")
+
+	report, err := StackImportStateReport(&st, &state)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, StateStatusPartial, report.Status)
+	testutil.AssertEqual(t, "vpc", st.VPC.state)
+	testutil.AssertEqual(t, "subnet-0", st.Subnet0.state)
+	testutil.AssertEqual(t, "subnet-a", st.SubnetA.state)
+	// Without an exact match, the first unmatched instance in the root module
+	// matches.
+	testutil.AssertEqual(t, "subnet-1", st.Subnet.state)
+	// Only resources in the root module match by type and name.
+	testutil.AssertEqual(t, "", st.Route.state)
+
+	testutil.AssertEqual(t, 1, len(report.Missing))
+	testutil.AssertEqual(
+		t,
+		`aws_route.public (found in state: module.vpc.aws_route.public)`,
+		report.Missing[0].String(),
+	)
+	if diff := testutil.Diff(report.Overflow, []StateResource{
+		{
+			Address: "aws_eip.orphan",
+			Type:    "aws_eip",
+			Name:    "orphan",
+		},
+		{
+			Address: "module.vpc.aws_route.public",
+			Module:  "module.vpc",
+			Type:    "aws_route",
+			Name:    "public",
+		},
+	}); diff != "" {
+		t.Fatal(diff)
+	}
+	testutil.AssertEqual(
+		t,
+		"aws_eip.orphan",
+		report.Overflow[0].ResourceAddress(),
+	)
+}
+
+func TestStackImportStateIndex(t *testing.T) {
+	const stateJSON = `{
+  "format_version": "1.0",
+  "values": {
+    "root_module": {
+      "resources": [
+        {"address": "aws_instance.web[0]", "mode": "managed", "type": "aws_instance", "name": "web", "index": 0, "values": {"id": "web-0"}},
+        {"address": "aws_instance.web[1]", "mode": "managed", "type": "aws_instance", "name": "web", "index": 1, "values": {"id": "web-1"}}
+      ]
+    }
+  }
+}`
+	var state tfjson.State
+	dec := json.NewDecoder(strings.NewReader(stateJSON))
+	dec.UseNumber()
+	testutil.AssertNoError(t, dec.Decode(&state))
+	type stack struct {
+		terra.Stack
+		Web *stateResource
+	}
+
+	t.Run("type and name", func(t *testing.T) {
+		st := stack{Web: &stateResource{typ: "aws_instance", name: "web"}}
+		report, err := importStateReport(&st, &state, nil)
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, StateStatusSync, report.Status)
+		testutil.AssertEqual(t, "web-0", st.Web.state)
+		// The other instance belongs to the resource, so it is not pruned.
+		testutil.AssertEqual(t, 0, len(report.Overflow))
+	})
+
+	t.Run("option", func(t *testing.T) {
+		st := stack{Web: &stateResource{typ: "aws_instance", name: "web"}}
+		report, err := importStateReport(
+			&st,
+			&state,
+			func(res terra.Resource) string {
+				return InstanceAddress("", res, 1)
+			},
+		)
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, "web-1", st.Web.state)
+		testutil.AssertEqual(t, 1, len(report.Overflow))
+		testutil.AssertEqual(t, "aws_instance.web[0]", report.Overflow[0].Address)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		st := stack{Web: &stateResource{typ: "aws_instance", name: "web"}}
+		report, err := importStateReport(
+			&st,
+			&state,
+			func(res terra.Resource) string {
+				return InstanceAddress("", res, 2)
+			},
+		)
+		testutil.AssertNoError(t, err)
+		testutil.AssertEqual(t, StateStatusPartial, report.Status)
+		testutil.AssertEqual(t, "", st.Web.state)
+	})
+}
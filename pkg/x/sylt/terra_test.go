@@ -1,11 +1,12 @@
 package sylt
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"testing"
+	"time"
 
 	"github.com/golingon/lingon/pkg/terra"
 	tu "github.com/golingon/lingon/pkg/testutil"
@@ -16,6 +17,7 @@ func TestTerraRun(t *testing.T) {
 	type test struct {
 		name        string
 		wfOpts      []WorkflowOption
+		planDiff    bool
 		expCallArgs [][]string
 	}
 
@@ -30,9 +32,21 @@ func TestTerraRun(t *testing.T) {
 				terraCallInit,
 				terraCallPlan,
 				terraCallShowPlan,
-				// How to simulate a plan diff?
-				// We cannot create a exec.ExitError, because it's fields are
-				// not exported.
+				terraCallShowState,
+			},
+		},
+		{
+			name: "plan diff",
+			wfOpts: []WorkflowOption{
+				WithWorkflowDryRun(false),
+				WithWorkflowDestroy(false),
+			},
+			planDiff: true,
+			expCallArgs: [][]string{
+				terraCallInit,
+				terraCallPlan,
+				terraCallShowPlan,
+				terraCallApply,
 				terraCallShowState,
 			},
 		},
@@ -71,9 +85,8 @@ func TestTerraRun(t *testing.T) {
 				terra.Stack
 			}
 			ctx := context.Background()
-			terraRec := &TerraExecRecorder{}
-			terraAct := Terra("test", &stack{})
-			terraAct.cmd = terraRec
+			terraRec := &TerraExecRecorder{planDiff: tt.planDiff}
+			terraAct := Terra("test", &stack{}, WithTerraCmder(terraRec))
 
 			wf := NewWorkflow(tt.wfOpts...)
 			if err := wf.Run(ctx, terraAct); err != nil {
@@ -97,24 +110,29 @@ func TestTerraRun(t *testing.T) {
 	}
 }
 
-var _ terraCmder = (*TerraExecRecorder)(nil)
+var _ TerraCmder = (*TerraExecRecorder)(nil)
 
 type TerraExecRecorder struct {
-	calls []terraCalls
+	// planDiff makes plan commands exit with code 2, meaning there is a diff.
+	planDiff bool
+	calls    []terraCalls
 }
 
 // Run implements TerraExecutor.
 func (t *TerraExecRecorder) Run(
 	ctx context.Context,
-	dir string,
-	stdout io.Writer,
-	stderr io.Writer,
-	args ...string,
+	cmd TerraCmd,
 ) error {
+	args := cmd.Args
+	stdout := cmd.Stdout
 	t.calls = append(t.calls, terraCalls{
-		dir:  dir,
+		dir:  cmd.Dir,
+		env:  cmd.Env,
 		args: args,
 	})
+	if len(args) > 0 && args[0] == "plan" && t.planDiff {
+		return &TerraExitError{Code: 2}
+	}
 	// If command is show, then we need to write some JSON.
 	if len(args) > 0 && args[0] == "show" {
 		// Write some JSON to stdout.
@@ -132,5 +150,126 @@ func (t *TerraExecRecorder) Run(
 
 type terraCalls struct {
 	dir  string
+	env  []string
 	args []string
 }
+
+func TestTerraCmdOptions(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	ctx := context.Background()
+	terraRec := &TerraExecRecorder{}
+	dir := t.TempDir()
+	terraAct := Terra(
+		"test",
+		&stack{},
+		WithTerraCmder(terraRec),
+		WithTerraDir(dir),
+		WithTerraEnv("TF_LOG=debug"),
+	)
+	tu.AssertNoError(t, terraAct.Run(ctx, RunOpts{DryRun: true}))
+	for _, call := range terraRec.calls {
+		tu.AssertEqual(t, dir, call.dir)
+		tu.AssertEqualSlice(t, []string{"TF_LOG=debug"}, call.env)
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newPrefixWriter(&buf, "[test] ")
+	for _, s := range []string{"first line\nsecond ", "line\n", "\nlast"} {
+		n, err := w.Write([]byte(s))
+		tu.AssertNoError(t, err)
+		tu.AssertEqual(t, len(s), n)
+	}
+	tu.AssertEqual(
+		t,
+		"[test] first line\n[test] second line\n[test] \n[test] last",
+		buf.String(),
+	)
+}
+
+func TestTerraPlanOptions(t *testing.T) {
+	type stack struct {
+		terra.Stack
+		Resource *dummyResource
+	}
+	ctx := context.Background()
+	res := &dummyResource{}
+	terraRec := &TerraExecRecorder{planDiff: true}
+	terraAct := Terra(
+		"test",
+		&stack{Resource: res},
+		WithTerraCmder(terraRec),
+		WithTerraTargets(res),
+		WithTerraReplace(res),
+		WithTerraRefresh(false),
+		WithTerraParallelism(4),
+		WithTerraLockTimeout(30*time.Second),
+	)
+	tu.AssertNoError(t, terraAct.validateOpts())
+	_, err := terraAct.Plan(ctx)
+	tu.AssertNoError(t, err)
+	tu.AssertNoError(t, terraAct.Apply(ctx))
+	_, err = terraAct.PlanDestroy(ctx)
+	tu.AssertNoError(t, err)
+
+	expCalls := [][]string{
+		{
+			"plan",
+			"-detailed-exitcode",
+			"-out=tfplan",
+			"-target=dummy.dummy",
+			"-replace=dummy.dummy",
+			"-refresh=false",
+			"-parallelism=4",
+			"-lock-timeout=30s",
+		},
+		terraCallShowPlan,
+		{
+			"apply",
+			"-input=false",
+			"-parallelism=4",
+			"-lock-timeout=30s",
+			"tfplan",
+		},
+		{
+			"plan",
+			"-detailed-exitcode",
+			"-out=tfplan",
+			"-destroy",
+			"-target=dummy.dummy",
+			"-refresh=false",
+			"-parallelism=4",
+			"-lock-timeout=30s",
+		},
+		terraCallShowPlan,
+	}
+	tu.AssertEqual(t, len(expCalls), len(terraRec.calls))
+	for i, expArgs := range expCalls {
+		tu.AssertEqualSlice(t, expArgs, terraRec.calls[i].args)
+	}
+
+	t.Run("resource not in stack", func(t *testing.T) {
+		terraAct := Terra(
+			"test",
+			&stack{Resource: res},
+			WithTerraTargets(&otherResource{}),
+		)
+		err := terraAct.validateOpts()
+		tu.AssertErrorMsg(t, err, "resource not in stack: other.other")
+	})
+}
+
+type otherResource struct {
+	dummyResource
+}
+
+func (o *otherResource) Type() string {
+	return "other"
+}
+
+func (o *otherResource) LocalName() string {
+	return "other"
+}
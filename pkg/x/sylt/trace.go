@@ -0,0 +1,38 @@
+package sylt
+
+import (
+	"context"
+
+	"github.com/golingon/lingon/pkg/workflow"
+)
+
+// Tracing uses the spans of [workflow.StartSpan]: set a tracer in the context
+// with [workflow.WithTracer] to record how long each action, and each phase of
+// a [TerraAction] (export, init, plan, apply and import state), takes.
+
+// startActionSpan starts a span for the phase of the action, e.g. running it
+// or one of its terra commands.
+func startActionSpan(
+	ctx context.Context,
+	action Actioner,
+	name string,
+	phase string,
+) (context.Context, *workflow.Span) {
+	ctx, span := workflow.StartSpan(ctx, name)
+	span.SetAttr("action_name", action.ActionName())
+	span.SetAttr("action_type", string(action.ActionType()))
+	span.SetAttr("phase", phase)
+	if envAction, ok := AsAction[EnvironmentActioner](action); ok &&
+		envAction.ActionEnvironment() != "" {
+		span.SetAttr("env", envAction.ActionEnvironment())
+	}
+	return ctx, span
+}
+
+// startPhaseSpan starts a span for a phase of a terra action.
+func (a *TerraAction[T]) startPhaseSpan(
+	ctx context.Context,
+	phase string,
+) (context.Context, *workflow.Span) {
+	return startActionSpan(ctx, a, phase, phase)
+}
@@ -0,0 +1,62 @@
+package sylt_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+	"github.com/golingon/lingon/pkg/workflow"
+	"github.com/golingon/lingon/pkg/x/sylt"
+	"github.com/golingon/lingon/pkg/x/sylt/sylttest"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestTrace(t *testing.T) {
+	type stack struct {
+		terra.Stack
+	}
+	fake := sylttest.NewFake()
+	tu.AssertNoError(t, fake.Plan(sylttest.KeyPlan, true, tfjson.Plan{
+		FormatVersion: "1.2",
+	}))
+	tu.AssertNoError(t, fake.State(tfjson.State{FormatVersion: "1.0"}))
+	action := sylt.Terra(
+		"network",
+		&stack{},
+		sylt.WithTerraCmder(fake),
+		sylt.WithTerraDir(t.TempDir()),
+		sylt.WithTerraOutput(io.Discard, io.Discard),
+		sylt.WithTerraEnvironment(sylt.Environment{Name: "dev"}),
+	)
+
+	rec := &workflow.SpanRecorder{}
+	ctx := workflow.WithTracer(context.Background(), workflow.NewTracer(rec))
+	wf := sylt.NewWorkflow(sylt.WithWorkflowDryRun(false))
+	tu.AssertNoError(t, wf.Run(ctx, action))
+
+	spans := rec.Spans()
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	tu.AssertEqualSlice(t, []string{
+		"export",
+		"init",
+		"plan",
+		"apply",
+		"import-state",
+		"run network",
+	}, names)
+	root := spans[len(spans)-1]
+	for _, s := range spans[:len(spans)-1] {
+		tu.AssertEqual(t, root.ID, s.ParentID)
+		tu.AssertEqual[any](t, "network", s.Attrs["action_name"])
+		tu.AssertEqual[any](t, "terra", s.Attrs["action_type"])
+		tu.AssertEqual[any](t, "dev", s.Attrs["env"])
+		tu.AssertEqual[any](t, s.Name, s.Attrs["phase"])
+	}
+	tu.AssertEqual[any](t, true, spans[2].Attrs["diff"])
+	tu.AssertEqual[any](t, "run", root.Attrs["phase"])
+}
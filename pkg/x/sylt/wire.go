@@ -0,0 +1,179 @@
+package sylt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golingon/lingon/pkg/terra"
+)
+
+var (
+	ErrDependencyNotRun = errors.New("dependency has not been run")
+	ErrDependencyCycle  = errors.New("dependency cycle")
+)
+
+// ActionDepender is implemented by actions which depend on other actions,
+// e.g. a [TerraAction] using the state of another [TerraAction] via [Wire].
+// A [Workflow] makes sure dependencies are run first.
+type ActionDepender interface {
+	// ActionDependencies returns the actions that must run before this action.
+	ActionDependencies() []Actioner
+}
+
+// terraInput is a function which sets values on the stack of a TerraAction,
+// from the state of another action.
+type terraInput struct {
+	from    Actioner
+	resolve func(ctx context.Context) error
+}
+
+// resumedAction is implemented by actions which are notified when a resumed
+// workflow skips them, because they succeeded in the previous run (see
+// [WithWorkflowResume]).
+type resumedAction interface {
+	resumed()
+}
+
+// Wire feeds the state of one [TerraAction] into the stack of another.
+// Before the "to" action exports its stack, fn is called with both stacks so
+// that values from the state of the "from" stack can be set as arguments on
+// the "to" stack, e.g. passing a VPC ID into an EKS cluster.
+//
+//	sylt.Wire(vpc, eks, func(from *VPCStack, to *EKSStack) error {
+//		var err error
+//		vpcState := sylt.RequireResourceState(from.VPC, &err)
+//		if err != nil {
+//			return err
+//		}
+//		to.Cluster.Args.VpcId = terra.String(vpcState.Id)
+//		return nil
+//	})
+//
+// The "from" action becomes a dependency of the "to" action, so a [Workflow]
+// will refuse to run "to" before "from" (see [Workflow.RunAll]).
+// If a resumed workflow skipped "from" because it succeeded in the previous
+// run, its state is imported before fn is called.
+func Wire[From, To terra.Exporter](
+	from *TerraAction[From],
+	to *TerraAction[To],
+	fn func(from From, to To) error,
+) {
+	to.inputs = append(to.inputs, terraInput{
+		from: from,
+		resolve: func(ctx context.Context) error {
+			if from.stateStatus == StateStatusUnknown && from.skipped {
+				if err := from.loadState(ctx); err != nil {
+					return err
+				}
+			}
+			if from.stateStatus == StateStatusUnknown {
+				return fmt.Errorf(
+					"%w: %s", ErrDependencyNotRun, from.ActionName(),
+				)
+			}
+			return fn(from.Stack, to.Stack)
+		},
+	})
+}
+
+// ActionDependencies returns the actions wired into this action with [Wire].
+func (a *TerraAction[T]) ActionDependencies() []Actioner {
+	deps := make([]Actioner, len(a.inputs))
+	for i, in := range a.inputs {
+		deps[i] = in.from
+	}
+	return deps
+}
+
+// resolveInputs sets the values wired into the stack with [Wire].
+func (a *TerraAction[T]) resolveInputs(ctx context.Context) error {
+	for _, in := range a.inputs {
+		if err := in.resolve(ctx); err != nil {
+			return fmt.Errorf(
+				"wiring state from %s: %w", in.from.ActionName(), err,
+			)
+		}
+	}
+	return nil
+}
+
+func (a *TerraAction[T]) resumed() {
+	a.skipped = true
+}
+
+// loadState imports the state of an action which was skipped by a resumed
+// workflow, so that it can be wired into other actions.
+func (a *TerraAction[T]) loadState(ctx context.Context) error {
+	if err := a.resolveInputs(ctx); err != nil {
+		return err
+	}
+	if err := a.Export(); err != nil {
+		return err
+	}
+	if err := a.Init(ctx); err != nil {
+		return fmt.Errorf("initializing stack %s: %w", a.Name, err)
+	}
+	if err := a.ImportState(ctx); err != nil {
+		return fmt.Errorf("getting state for stack %s: %w", a.Name, err)
+	}
+	return nil
+}
+
+// sortActions orders the actions so that dependencies (see [ActionDepender])
+// come before the actions depending on them.
+// Otherwise the order of the actions is kept.
+// Dependencies which are not in the list are ignored.
+func sortActions(actions []Actioner) ([]Actioner, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	index := func(action Actioner) int {
+		for i, a := range actions {
+			if isSameAction(a, action) {
+				return i
+			}
+		}
+		return -1
+	}
+	state := make([]int, len(actions))
+	sorted := make([]Actioner, 0, len(actions))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf(
+				"%w: %s", ErrDependencyCycle, actions[i].ActionName(),
+			)
+		}
+		state[i] = visiting
+		if depender, ok := AsAction[ActionDepender](actions[i]); ok {
+			for _, dep := range depender.ActionDependencies() {
+				j := index(dep)
+				if j < 0 {
+					continue
+				}
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = visited
+		sorted = append(sorted, actions[i])
+		return nil
+	}
+	for i := range actions {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func isSameAction(a, b Actioner) bool {
+	return a.ActionName() == b.ActionName() && a.ActionType() == b.ActionType()
+}
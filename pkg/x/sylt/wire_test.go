@@ -0,0 +1,120 @@
+package sylt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/golingon/lingon/pkg/terra"
+	tu "github.com/golingon/lingon/pkg/testutil"
+)
+
+func TestWire(t *testing.T) {
+	type fromStack struct {
+		terra.Stack
+	}
+	type toStack struct {
+		terra.Stack
+		value string `lingon:"-"`
+	}
+	ctx := context.Background()
+	var order []string
+	from := Terra("from", &fromStack{}, WithTerraCmder(&TerraExecRecorder{}))
+	to := Terra("to", &toStack{}, WithTerraCmder(&TerraExecRecorder{}))
+	Wire(from, to, func(from *fromStack, to *toStack) error {
+		order = append(order, "wire")
+		to.value = "from state"
+		return nil
+	})
+
+	t.Run("dependency not run", func(t *testing.T) {
+		wf := NewWorkflow()
+		err := wf.Run(ctx, to)
+		tu.AssertEqual(t, true, errors.Is(err, ErrDependencyNotRun))
+	})
+
+	t.Run("run all", func(t *testing.T) {
+		wf := NewWorkflow()
+		tu.AssertNoError(t, wf.RunAll(ctx, to, from))
+		tu.AssertEqualSlice(t, []string{"wire"}, order)
+		tu.AssertEqual(t, "from state", to.Stack.value)
+		tu.AssertEqualSlice(
+			t,
+			[]string{"from", "to"},
+			[]string{wf.actions[0].ActionName(), wf.actions[1].ActionName()},
+		)
+	})
+}
+
+func TestWireResume(t *testing.T) {
+	type fromStack struct {
+		terra.Stack
+	}
+	type toStack struct {
+		terra.Stack
+	}
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal.json")
+	errBoom := errors.New("boom")
+
+	newActions := func(wireErr error) (*TerraAction[*fromStack], *TerraAction[*toStack], *TerraExecRecorder) {
+		rec := &TerraExecRecorder{}
+		from := Terra("from", &fromStack{}, WithTerraCmder(rec))
+		to := Terra("to", &toStack{}, WithTerraCmder(&TerraExecRecorder{}))
+		Wire(from, to, func(*fromStack, *toStack) error {
+			return wireErr
+		})
+		return from, to, rec
+	}
+
+	// The first run fails when wiring "from" into "to".
+	from, to, _ := newActions(errBoom)
+	wf := NewWorkflow(WithWorkflowJournal(path))
+	err := wf.RunAll(ctx, from, to)
+	tu.ErrorIs(t, err, errBoom)
+
+	// The resumed run skips "from", which imports its state to wire it.
+	from, to, rec := newActions(nil)
+	wf = NewWorkflow(WithWorkflowJournal(path), WithWorkflowResume(true))
+	tu.AssertNoError(t, wf.RunAll(ctx, from, to))
+	tu.AssertEqual(t, StateStatusEmpty, from.stateStatus)
+	tu.True(t, slices.ContainsFunc(rec.calls, func(c terraCalls) bool {
+		return c.args[0] == "show"
+	}), "state of the skipped action should be imported")
+	tu.False(t, slices.ContainsFunc(rec.calls, func(c terraCalls) bool {
+		return c.args[0] == "plan" || c.args[0] == "apply"
+	}), "skipped action should not be planned or applied")
+}
+
+type depAction struct {
+	name string
+	deps []Actioner
+}
+
+func (d *depAction) ActionName() string                     { return d.name }
+func (d *depAction) ActionType() ActionType                 { return "dep" }
+func (d *depAction) Run(context.Context, RunOpts) error     { return nil }
+func (d *depAction) Cleanup(context.Context, RunOpts) error { return nil }
+func (d *depAction) ActionDependencies() []Actioner         { return d.deps }
+
+func TestSortActions(t *testing.T) {
+	a := &depAction{name: "a"}
+	b := &depAction{name: "b", deps: []Actioner{a}}
+	c := &depAction{name: "c", deps: []Actioner{a, b}}
+	d := &depAction{name: "d"}
+
+	sorted, err := sortActions([]Actioner{c, d, b, a})
+	tu.AssertNoError(t, err)
+	names := make([]string, len(sorted))
+	for i, s := range sorted {
+		names[i] = s.ActionName()
+	}
+	tu.AssertEqualSlice(t, []string{"a", "b", "c", "d"}, names)
+
+	a.deps = []Actioner{c}
+	_, err = sortActions([]Actioner{c, d, b, a})
+	tu.AssertEqual(t, true, errors.Is(err, ErrDependencyCycle))
+}
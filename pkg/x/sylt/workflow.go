@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"sync"
 )
 
@@ -25,6 +27,7 @@ func NewWorkflow(opts ...WorkflowOption) *Workflow {
 type Workflow struct {
 	opts    workflowOpts
 	actions []Actioner
+	journal *Journal
 	mu      sync.Mutex
 }
 
@@ -40,15 +43,72 @@ func WithWorkflowDestroy(b bool) WorkflowOption {
 	return func(o *workflowOpts) { o.Destroy = b }
 }
 
+// WithWorkflowDrift enables drift detection for Workflow.
+// Actions are run with [RunOpts.Drift] and [RunOpts.DryRun] set, so nothing
+// is applied or destroyed, even by actions which do not handle drift.
+// Use [Workflow.DriftReport] to get the results.
+func WithWorkflowDrift(b bool) WorkflowOption {
+	return func(o *workflowOpts) { o.Drift = b }
+}
+
+// WithWorkflowJournal records the actions run by Workflow in a [Journal] at
+// the given path (e.g. [DefaultJournalPath]).
+// An empty path disables the journal.
+func WithWorkflowJournal(path string) WorkflowOption {
+	return func(o *workflowOpts) { o.JournalPath = path }
+}
+
+// WithWorkflowResume resumes a previous run of Workflow, recorded in the
+// journal (see [WithWorkflowJournal]).
+// Actions which succeeded in the previous run are skipped, so the workflow
+// continues from the action that failed.
+// Note that skipped actions are not run at all. A skipped [TerraAction] only
+// imports its state when it is wired into another action (see [Wire]).
+func WithWorkflowResume(b bool) WorkflowOption {
+	return func(o *workflowOpts) { o.Resume = b }
+}
+
+// WithWorkflowMiddleware wraps every action run and cleaned up by Workflow
+// with the middlewares, e.g. [RetryMiddleware].
+// Workflow middlewares wrap any middlewares set for the action with [Use].
+func WithWorkflowMiddleware(mid ...Middleware) WorkflowOption {
+	return func(o *workflowOpts) { o.Middlewares = append(o.Middlewares, mid...) }
+}
+
+// WithWorkflowEnvironment restricts Workflow to actions for the named
+// environment (see [Environment]), so that e.g. a dev run cannot touch prod
+// state.
+// Running an action for another environment fails with
+// [ErrEnvironmentMismatch].
+// Actions without an environment are always allowed.
+func WithWorkflowEnvironment(name string) WorkflowOption {
+	return func(o *workflowOpts) { o.Environment = name }
+}
+
+// WithWorkflowApprover sets the [Approver] which must approve the changes of
+// each action before they are applied, e.g. [TerminalApprover].
+// Actions which are skipped by the approver are not applied, and the workflow
+// continues with the next action.
+func WithWorkflowApprover(a Approver) WorkflowOption {
+	return func(o *workflowOpts) { o.Approver = a }
+}
+
 type workflowOpts struct {
-	DryRun  bool
-	Destroy bool
+	DryRun      bool
+	Destroy     bool
+	Drift       bool
+	JournalPath string
+	Resume      bool
+	Approver    Approver
+	Middlewares []Middleware
+	Environment string
 }
 
 var defaultWorkflowOpts = func() workflowOpts {
 	return workflowOpts{
 		DryRun:  true,
 		Destroy: false,
+		Drift:   false,
 	}
 }
 
@@ -63,23 +123,154 @@ func (w *Workflow) Run(ctx context.Context, action Actioner) error {
 	if action.ActionType() == "" {
 		return ErrMissingActionType
 	}
+	if err := w.checkEnv(action); err != nil {
+		return err
+	}
+	if err := w.checkDependencies(action); err != nil {
+		return err
+	}
 	if err := w.addAction(action); err != nil {
 		return fmt.Errorf("adding action to client: %w", err)
 	}
-	if err := action.Run(ctx, RunOpts{
-		DryRun:  w.opts.DryRun,
-		Destroy: w.opts.Destroy,
-	}); err != nil {
-		return fmt.Errorf("running action %s: %w", action.ActionName(), err)
+	journal, err := w.loadJournal(false)
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		if err := w.runAction(ctx, action); err != nil {
+			return fmt.Errorf("running action %s: %w", action.ActionName(), err)
+		}
+		return nil
+	}
+
+	if w.opts.Resume {
+		entry, ok := journal.Entry(action.ActionName(), action.ActionType())
+		if ok && (entry.Outcome == ActionOutcomeSucceeded ||
+			entry.Outcome == ActionOutcomeResumed) {
+			if r, ok := AsAction[resumedAction](action); ok {
+				r.resumed()
+			}
+			if err := journal.finish(action, ActionOutcomeResumed, nil); err != nil {
+				return fmt.Errorf("writing journal: %w", err)
+			}
+			return nil
+		}
+	}
+	if err := journal.start(action); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	runErr := w.runAction(ctx, action)
+	outcome := ActionOutcomeSucceeded
+	if runErr != nil {
+		outcome = ActionOutcomeFailed
+	}
+	if err := journal.finish(action, outcome, runErr); err != nil {
+		return errors.Join(runErr, fmt.Errorf("writing journal: %w", err))
+	}
+	if runErr != nil {
+		return fmt.Errorf("running action %s: %w", action.ActionName(), runErr)
 	}
 	return nil
 }
 
+// RunAll runs the given actions, ordered so that dependencies (see
+// [ActionDepender]) run before the actions depending on them.
+// Apart from that, the actions run in the given order.
+func (w *Workflow) RunAll(ctx context.Context, actions ...Actioner) error {
+	sorted, err := sortActions(actions)
+	if err != nil {
+		return err
+	}
+	for _, action := range sorted {
+		if err := w.Run(ctx, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDependencies makes sure that the dependencies of the action have already
+// been run by the workflow.
+func (w *Workflow) checkDependencies(action Actioner) error {
+	depender, ok := AsAction[ActionDepender](action)
+	if !ok {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, dep := range depender.ActionDependencies() {
+		if !slices.ContainsFunc(w.actions, func(a Actioner) bool {
+			return isSameAction(a, dep)
+		}) {
+			return fmt.Errorf(
+				"running action %s: %w: %s",
+				action.ActionName(), ErrDependencyNotRun, dep.ActionName(),
+			)
+		}
+	}
+	return nil
+}
+
+func (w *Workflow) runAction(ctx context.Context, action Actioner) error {
+	ctx, span := startActionSpan(
+		ctx,
+		action,
+		"run "+action.ActionName(),
+		string(ActionPhaseRun),
+	)
+	err := Use(action, w.opts.Middlewares...).Run(ctx, RunOpts{
+		// Drift detection never changes anything, so actions which do not
+		// handle drift must at least not apply anything.
+		DryRun:   w.opts.DryRun || w.opts.Drift,
+		Destroy:  w.opts.Destroy,
+		Drift:    w.opts.Drift,
+		Approver: w.opts.Approver,
+	})
+	span.End(ctx, err)
+	return err
+}
+
+// Journal returns the journal of the workflow, or nil if the journal is not
+// enabled (see [WithWorkflowJournal]).
+func (w *Workflow) Journal() (*Journal, error) {
+	return w.loadJournal(false)
+}
+
+// loadJournal returns the journal for the workflow, creating it if needed.
+// When resuming, or if existing is true (e.g. to clean up), the journal from
+// the previous run is loaded.
+// A new journal is only written when the first action starts, so that the
+// journal of the previous run is kept until then.
+func (w *Workflow) loadJournal(existing bool) (*Journal, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.opts.JournalPath == "" {
+		return nil, nil
+	}
+	if w.journal != nil {
+		return w.journal, nil
+	}
+	if w.opts.Resume || existing {
+		journal, err := LoadJournal(w.opts.JournalPath)
+		switch {
+		case err == nil:
+			w.journal = journal
+			return journal, nil
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("loading journal: %w", err)
+		}
+	}
+	w.journal = newJournal(w.opts.JournalPath)
+	return w.journal, nil
+}
+
 type CleanupOption func(*cleanupOpts)
 
 type cleanupOpts struct {
-	dryRun  bool
-	destroy bool
+	dryRun      bool
+	destroy     bool
+	approver    Approver
+	middlewares []Middleware
 }
 
 // WithCleanupDryRun sets the dry run option for Cleanup.
@@ -117,8 +308,10 @@ func WithCleanupDestroy(b bool) CleanupOption {
 //	})
 func (w *Workflow) Cleanup(ctx context.Context, opts ...CleanupOption) error {
 	fOpts := cleanupOpts{
-		dryRun:  w.opts.DryRun,
-		destroy: w.opts.Destroy,
+		dryRun:      w.opts.DryRun,
+		destroy:     w.opts.Destroy,
+		approver:    w.opts.Approver,
+		middlewares: w.opts.Middlewares,
 	}
 	for _, opt := range opts {
 		opt(&fOpts)
@@ -127,20 +320,146 @@ func (w *Workflow) Cleanup(ctx context.Context, opts ...CleanupOption) error {
 	if !fOpts.destroy {
 		return nil
 	}
+	// Drift detection never changes anything, including destroying.
+	if w.opts.Drift {
+		return nil
+	}
 
+	journal, err := w.loadJournal(true)
+	if err != nil {
+		return err
+	}
 	// Iterate over actions in reverse.
 	for i := len(w.actions) - 1; i >= 0; i-- {
-		action := w.actions[i]
-		if err := action.Cleanup(ctx, RunOpts{
-			DryRun:  fOpts.dryRun,
-			Destroy: fOpts.destroy,
-		}); err != nil {
-			return fmt.Errorf("destroying %s: %w", action.ActionName(), err)
+		if err := cleanupAction(ctx, journal, w.actions[i], fOpts); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// CleanupJournal destroys the actions recorded in the journal of a previous
+// run (see [WithWorkflowJournal]), in the reverse order they were run.
+// It is useful when the process that ran the actions died before it could
+// clean up.
+// The resolver creates the actions from the journal entries, e.g.
+// [TerraResolver], or [TerraEnvResolver] for actions run in an environment.
+// Like [Workflow.Cleanup], nothing happens unless the destroy option is set.
+func (w *Workflow) CleanupJournal(
+	ctx context.Context,
+	resolve ActionResolver,
+	opts ...CleanupOption,
+) error {
+	fOpts := cleanupOpts{
+		dryRun:      w.opts.DryRun,
+		destroy:     w.opts.Destroy,
+		approver:    w.opts.Approver,
+		middlewares: w.opts.Middlewares,
+	}
+	for _, opt := range opts {
+		opt(&fOpts)
+	}
+	if !fOpts.destroy || w.opts.Drift {
+		return nil
+	}
+	if w.opts.JournalPath == "" {
+		return errors.New("journal is not enabled")
+	}
+	journal, err := LoadJournal(w.opts.JournalPath)
+	if err != nil {
+		return err
+	}
+	entries := slices.Clone(journal.Entries)
+	for _, entry := range slices.Backward(entries) {
+		if entry.Outcome == ActionOutcomeDestroyed {
+			continue
+		}
+		action, err := resolve(entry)
+		if err != nil {
+			return fmt.Errorf("resolving action %s: %w", entry.Name, err)
+		}
+		if action == nil {
+			continue
+		}
+		if err := cleanupAction(ctx, journal, action, fOpts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cleanupAction(
+	ctx context.Context,
+	journal *Journal,
+	action Actioner,
+	opts cleanupOpts,
+) error {
+	ctx, span := startActionSpan(
+		ctx,
+		action,
+		"cleanup "+action.ActionName(),
+		string(ActionPhaseCleanup),
+	)
+	err := Use(action, opts.middlewares...).Cleanup(ctx, RunOpts{
+		DryRun:   opts.dryRun,
+		Destroy:  opts.destroy,
+		Approver: opts.approver,
+	})
+	span.End(ctx, err)
+	// A skipped destroy is not an error, but the action must stay in the
+	// journal so that a later cleanup destroys it.
+	if errors.Is(err, ErrDestroySkipped) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("destroying %s: %w", action.ActionName(), err)
+	}
+	if journal == nil || opts.dryRun {
+		return nil
+	}
+	if err := journal.finish(action, ActionOutcomeDestroyed, nil); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+// DriftReport returns the consolidated drift report for the actions that have
+// been run with drift detection enabled (see [WithWorkflowDrift]).
+// Actions that do not implement [DriftDetector] are not included.
+func (w *Workflow) DriftReport() *DriftReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	report := DriftReport{
+		Results: []DriftResult{},
+	}
+	for _, action := range w.actions {
+		detector, ok := AsAction[DriftDetector](action)
+		if !ok {
+			continue
+		}
+		if result, ok := detector.DriftResult(); ok {
+			report.Results = append(report.Results, result)
+		}
+	}
+	return &report
+}
+
+// sameStateLocation returns the state location of the actions if their
+// backends store the state in the same location.
+func sameStateLocation(a, b Actioner) (string, bool) {
+	al, ok := AsAction[stateLocator](a)
+	if !ok {
+		return "", false
+	}
+	bl, ok := AsAction[stateLocator](b)
+	if !ok {
+		return "", false
+	}
+	aLoc, aOK := al.stateLocation()
+	bLoc, bOK := bl.stateLocation()
+	return aLoc, aOK && bOK && aLoc == bLoc
+}
+
 // addAction appends the given action to the client's list of action.
 // This ensures all action name and type pairs are unique.
 // The list of actions is used to destroy anything that the actions have
@@ -158,6 +477,15 @@ func (w *Workflow) addAction(action Actioner) error {
 				action.ActionType(),
 			)
 		}
+		if loc, ok := sameStateLocation(exAction, action); ok {
+			return fmt.Errorf(
+				"%w: %s and %s (state: %s)",
+				ErrStateKeyCollision,
+				exAction.ActionName(),
+				action.ActionName(),
+				loc,
+			)
+		}
 	}
 	w.actions = append(w.actions, action)
 	return nil